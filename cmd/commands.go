@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"workmate/internal/back/config"
+)
+
+const commandsUsage = `usage:
+  workmate [flags]                     run the server
+  workmate config check [-env] [path]  validate a config file
+  workmate store <command> [flags]     inspect and maintain the task store
+                                       (ls, show, fsck, purge, export, import)
+`
+
+func isCommand(args []string) bool {
+	return len(args) > 0 && !strings.HasPrefix(args[0], "-")
+}
+
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	switch args[0] {
+	case "config":
+		return runConfigCommand(args[1:], stdout, stderr)
+	case "store":
+		return runStoreCommand(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], commandsUsage)
+		return 2
+	}
+}
+
+func runConfigCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprint(stderr, commandsUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("workmate config check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	withEnv := fs.Bool("env", false, "also apply "+config.EnvPrefix+"* environment overrides")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	path := fs.Arg(0)
+	if path == "" {
+		path = defaultConfigPath
+		if envPath, ok := os.LookupEnv(configPathEnv); ok && envPath != "" {
+			path = envPath
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		return 1
+	}
+
+	loader := config.Loader{Path: path}
+	if *withEnv {
+		loader.LookupEnv = os.LookupEnv
+	}
+	_, _, err := loader.Load()
+	var validationErr *config.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		for _, issue := range validationErr.Issues {
+			fmt.Fprintln(stderr, formatIssue(path, issue))
+		}
+		fmt.Fprintf(stderr, "%s: %d problem(s) found\n", path, len(validationErr.Issues))
+		return 1
+	case err != nil:
+		fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s: OK\n", path)
+	return 0
+}
+
+func formatIssue(path string, issue config.Issue) string {
+	location := path
+	if issue.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", path, issue.Line, issue.Column)
+	}
+	if issue.Key == "" {
+		return fmt.Sprintf("%s: %s", location, issue.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, issue.Key, issue.Message)
+}
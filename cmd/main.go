@@ -2,49 +2,145 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	backapi "workmate/internal/back/api"
+	"workmate/internal/back/audit"
 	"workmate/internal/back/config"
 	fileutil "workmate/internal/back/file"
+	"workmate/internal/back/logging"
+	"workmate/internal/back/metrics"
+	"workmate/internal/back/reload"
+	"workmate/internal/back/storage"
 	"workmate/internal/back/task"
+	"workmate/internal/back/tracing"
 	frontui "workmate/internal/front/ui"
 )
 
 func main() {
+	if isCommand(os.Args[1:]) {
+		os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+	}
 
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-
-	router := setupRouter()
+	opts, err := parseFlags(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		exitOnFlagError(err)
+	}
 
-	cfg, err := config.Load("config.yml")
+	cfg, sources, err := opts.loader.Load()
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to load config")
+		log.Fatal().Err(err).Str("path", opts.loader.Path).Msg("failed to load config")
+	}
+	if opts.printConfig {
+		if err := printEffectiveConfig(os.Stdout, opts.loader.Path, cfg, sources); err != nil {
+			log.Fatal().Err(err).Msg("print config")
+		}
+		return
 	}
 
-	if cfg.DataDir == "data" {
-		cfg.DataDir = "storage/data"
+	if err := logging.Setup(logging.Options{
+		Level:  cfg.Log.Level,
+		Format: cfg.Log.Format,
+		Output: cfg.Log.Output,
+		File: logging.FileOptions{
+			Path:       cfg.Log.File.Path,
+			MaxSizeMB:  cfg.Log.File.MaxSizeMB,
+			MaxBackups: cfg.Log.File.MaxBackups,
+			MaxAgeDays: cfg.Log.File.MaxAgeDays,
+			Compress:   cfg.Log.File.Compress,
+		},
+		Packages: cfg.Log.Packages,
+	}); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
 	}
+	defer func() { _ = logging.Close() }()
+
+	router := setupRouter()
 
 	if err := fileutil.EnsureDir(cfg.DataDir); err != nil {
 		log.Fatal().Err(err).Str("dir", cfg.DataDir).Msg("ensure data dir")
 	}
+	// Held for the server's lifetime so offline store repairs cannot run
+	// next to it.
+	dataDirLock, err := task.LockDataDir(cfg.DataDir, false)
+	if err != nil {
+		log.Fatal().Err(err).Str("dir", cfg.DataDir).Msg("lock data dir")
+	}
+	defer func() { _ = dataDirLock.Unlock() }()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Enabled:     cfg.Tracing.Enabled,
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		FilePath:    cfg.Tracing.FilePath,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: cfg.Tracing.ServiceName,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to set up tracing")
+	}
+
+	auditLog, err := openAuditLog(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open audit log")
+	}
+	if auditLog != nil {
+		defer func() { _ = auditLog.Close() }()
+		router.Use(backapi.Audit(auditLog))
+	}
+
+	store, err := task.OpenStore(context.Background(), task.StoreOptions{
+		Driver:         cfg.Store.Driver,
+		DataDir:        cfg.DataDir,
+		Path:           cfg.Store.Path,
+		ReservationTTL: cfg.Cluster.LeaseTTL,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Str("driver", cfg.Store.Driver).Msg("failed to open task store")
+	}
+	defer func() { _ = store.Close() }()
 
-	taskManager := buildTaskManager(cfg)
-	wireAPI(router, taskManager)
+	archives, err := openArchiveStorage(cfg, store)
+	if err != nil {
+		log.Fatal().Err(err).Str("driver", cfg.ArchiveStorage.Driver).Msg("failed to set up archive storage")
+	}
 
 	baseCtx, baseCancel := context.WithCancel(context.Background())
-	taskManager.SetBaseContext(baseCtx)
+	taskManager := buildTaskManager(baseCtx, cfg, store, archives, auditLog)
+	wireAPI(router, taskManager, cfg.ArchiveStorage)
+
+	taskManager.CompactPeriodically(baseCtx, cfg.Journal.CompactInterval)
+	taskManager.RunCluster(baseCtx)
+
+	reloader := reload.New(opts.loader, cfg, func(next config.Config, live []config.Change) error {
+		return applyConfig(taskManager, next, live)
+	})
+	reloader.WatchSignals(baseCtx)
+	if cfg.Reload.Watch {
+		reloader.WatchFile(baseCtx, cfg.Reload.Interval)
+	}
+
+	admin := backapi.NewAdmin(taskManager, cfg.Admin.Token)
+	admin.UseReloader(reloader)
+	if auditLog != nil {
+		admin.UseAudit(auditLog)
+	}
+	admin.RegisterRoutes(router)
+	backapi.NewHealth(taskManager, backapi.HealthOptions{
+		DataDir:          cfg.DataDir,
+		MinFreeDiskBytes: cfg.Health.MinFreeDiskBytes(),
+	}).RegisterRoutes(router)
 
 	const (
 		readHeaderTimeout = 5 * time.Second
@@ -61,30 +157,122 @@ func main() {
 
 	waitForShutdownSignal()
 
-	gracefulShutdown(srv, baseCancel, taskManager, shutdownTimeout)
+	gracefulShutdown(srv, baseCancel, taskManager, shutdownTracing, shutdownTimeout)
 }
 
 func setupRouter() *gin.Engine {
 	r := gin.New()
 
 	r.Use(gin.Recovery())
+	r.Use(backapi.RequestID())
 	r.Use(backapi.ZerologLogger())
+	r.Use(backapi.OtelTracing())
+	r.Use(backapi.PrometheusMetrics())
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 	return r
 }
 
-func buildTaskManager(cfg config.Config) *task.Manager {
+// openAuditLog returns nil when the audit log is disabled.
+func openAuditLog(cfg config.Config) (*audit.Log, error) {
+	if !cfg.Audit.Enabled {
+		return nil, nil
+	}
+	return audit.Open(audit.Options{
+		Dir:          filepath.Join(cfg.DataDir, "audit"),
+		MaxSizeBytes: int64(cfg.Audit.MaxSizeMB) << 20,
+	})
+}
+
+func openArchiveStorage(cfg config.Config, store task.TaskStore) (storage.ArchiveStorage, error) {
+	if cfg.ArchiveStorage.Driver != storage.DriverS3 {
+		return storage.NewLocal(store.ArchivePath), nil
+	}
+	s3 := cfg.ArchiveStorage.S3
+	return storage.NewS3(storage.S3Options{
+		Endpoint:        s3.Endpoint,
+		Bucket:          s3.Bucket,
+		Region:          s3.Region,
+		AccessKeyID:     s3.AccessKeyID,
+		SecretAccessKey: s3.SecretAccessKey,
+		UseSSL:          s3.UseSSL,
+		Prefix:          s3.Prefix,
+	})
+}
+
+func buildTaskManager(baseCtx context.Context, cfg config.Config, store task.TaskStore, archives storage.ArchiveStorage, auditLog *audit.Log) *task.Manager {
 	tm := task.NewManagerWithOptions(task.Options{
 		DataDir:            cfg.DataDir,
 		AllowedExtensions:  cfg.AllowedExtensions,
 		MaxConcurrentTasks: cfg.MaxConcurrentTasks,
+		DownloadTimeout:    cfg.DownloadTimeout,
+		Store:              store,
+		FailOnCorrupt:      cfg.Store.FailOnCorrupt,
+		Archives:           archives,
+		Quota: task.QuotaOptions{
+			MinFreeBytes:    cfg.Health.MinFreeDiskBytes(),
+			MaxArchiveBytes: cfg.ArchiveStorage.QuotaMB << 20,
+		},
+		Journal: task.JournalOptions{
+			Enabled:      cfg.Journal.Enabled,
+			CompactEvery: cfg.Journal.CompactEvery,
+		},
+		Cluster: task.ClusterOptions{
+			Enabled:            cfg.Cluster.Enabled,
+			InstanceID:         cfg.Cluster.InstanceID,
+			LeaseTTL:           cfg.Cluster.LeaseTTL,
+			MaxConcurrentTasks: cfg.Cluster.MaxConcurrentTasks,
+			CacheTTL:           cfg.Cluster.CacheTTL,
+		},
+		Audit: auditLog,
 	})
+	// Set before loading: LoadFromDisk queues the tasks that were waiting
+	// for a slot when the process stopped.
+	tm.SetBaseContext(baseCtx)
 
-	_ = tm.LoadFromDisk()
+	if err := tm.LoadFromDisk(); err != nil {
+		if errors.Is(err, task.ErrCorruptRecords) {
+			log.Fatal().Err(err).Msg("corrupt task records found and store.fail_on_corrupt is set")
+		}
+		log.Error().Err(err).Msg("load tasks from disk failed")
+	}
+	if id := tm.InstanceID(); id != "" {
+		log.Info().Str("instance", id).Dur("lease_ttl", cfg.Cluster.LeaseTTL).Int("cluster_max_concurrent_tasks", cfg.Cluster.MaxConcurrentTasks).Msg("cluster mode enabled")
+	}
+	if err := metrics.RegisterTaskSource(tm); err != nil {
+		log.Warn().Err(err).Msg("register task metrics failed")
+	}
 	return tm
 }
 
-func wireAPI(router *gin.Engine, tm *task.Manager) {
+// applyConfig applies only the fields listed in live, so a reload that does
+// not touch max_concurrent_tasks keeps a limit set through the admin API.
+func applyConfig(tm *task.Manager, cfg config.Config, live []config.Change) error {
+	changed := make(map[string]bool, len(live))
+	for _, c := range live {
+		changed[c.Field] = true
+	}
+	if changed["max_concurrent_tasks"] {
+		if err := tm.SetMaxConcurrentTasks(cfg.MaxConcurrentTasks); err != nil {
+			return err
+		}
+	}
+	if changed["allowed_extensions"] {
+		tm.SetAllowedExtensions(cfg.AllowedExtensions)
+	}
+	if changed["download_timeout"] {
+		tm.SetDownloadTimeout(cfg.DownloadTimeout)
+	}
+	if changed["log.level"] || changed["log.packages"] {
+		return logging.SetLevels(cfg.Log.Level, cfg.Log.Packages)
+	}
+	return nil
+}
+
+func wireAPI(router *gin.Engine, tm *task.Manager, archiveCfg config.ArchiveStorage) {
 	apiHandler := backapi.NewAPI(tm)
+	if archiveCfg.Download == "redirect" {
+		apiHandler.UseArchiveRedirect(archiveCfg.PresignTTL)
+	}
 	apiHandler.RegisterRoutes(router)
 
 	uiHandler := frontui.NewUI(tm)
@@ -106,7 +294,9 @@ func waitForShutdownSignal() {
 	log.Info().Msg("shutdown signal received")
 }
 
-func gracefulShutdown(srv *http.Server, cancelBase context.CancelFunc, tm *task.Manager, timeout time.Duration) {
+func gracefulShutdown(srv *http.Server, cancelBase context.CancelFunc, tm *task.Manager, shutdownTracing func(context.Context) error, timeout time.Duration) {
+	tm.Drain("shutting down")
+
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
@@ -118,5 +308,11 @@ func gracefulShutdown(srv *http.Server, cancelBase context.CancelFunc, tm *task.
 	if !done {
 		log.Warn().Msg("background workers did not finish before timeout")
 	}
+	if err := tm.CloseJournal(ctx); err != nil {
+		log.Warn().Err(err).Msg("final journal compaction failed")
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Warn().Err(err).Msg("tracing shutdown warning")
+	}
 	log.Info().Msg("server exited cleanly")
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"workmate/internal/back/config"
+)
+
+const (
+	defaultConfigPath = "config.yml"
+	configPathEnv     = config.EnvPrefix + "CONFIG"
+)
+
+type cliOptions struct {
+	loader      config.Loader
+	printConfig bool
+}
+
+func parseFlags(args []string, lookupEnv func(string) (string, bool)) (cliOptions, error) {
+	fs := flag.NewFlagSet("workmate", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to the config file (env "+configPathEnv+", default "+defaultConfigPath+")")
+	fs.Int("port", 0, "HTTP port, overrides config and env")
+	fs.String("data-dir", "", "data directory, overrides config and env")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration with value sources and exit")
+	if err := fs.Parse(args); err != nil {
+		return cliOptions{}, err
+	}
+
+	flagKeys := map[string]string{"port": "port", "data-dir": "data_dir"}
+	overrides := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok {
+			overrides[key] = f.Value.String()
+		}
+	})
+
+	path := *configPath
+	if path == "" {
+		if envPath, ok := lookupEnv(configPathEnv); ok && envPath != "" {
+			path = envPath
+		} else {
+			path = defaultConfigPath
+		}
+	}
+
+	return cliOptions{
+		loader:      config.Loader{Path: path, LookupEnv: lookupEnv, Flags: overrides},
+		printConfig: *printConfig,
+	}, nil
+}
+
+func printEffectiveConfig(w io.Writer, path string, cfg config.Config, sources config.Sources) error {
+	if _, err := fmt.Fprintf(w, "# config file: %s\n", path); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, s := range config.Describe(cfg, sources) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Key, s.Value, s.Source)
+	}
+	return tw.Flush()
+}
+
+func exitOnFlagError(err error) {
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	os.Exit(2)
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"workmate/internal/back/audit"
+	"workmate/internal/back/config"
+	fileutil "workmate/internal/back/file"
+	"workmate/internal/back/task"
+)
+
+const storeUsage = `usage:
+  workmate store ls [-status s] [-since t] [-until t] [-limit n] [-json]
+  workmate store show <task-id>
+  workmate store fsck [-fix]
+  workmate store purge -older-than d [-status s] [-dry-run]
+  workmate store export -o file.tar.gz
+  workmate store import [-overwrite] file.tar.gz
+
+common flags: -config path, -data-dir dir
+`
+
+// storeFlags are shared by every store subcommand.
+type storeFlags struct {
+	configPath string
+	dataDir    string
+	// exclusive is set by commands that change the store. They take the data
+	// dir lock so they cannot run next to a server, and refuse to run while
+	// the journal holds changes the store does not have yet. The others open
+	// the store read-only.
+	exclusive bool
+	lock      *fileutil.FileLock
+}
+
+func (f *storeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.configPath, "config", "", "path to the config file (env "+configPathEnv+", default "+defaultConfigPath+")")
+	fs.StringVar(&f.dataDir, "data-dir", "", "override data_dir from the config")
+}
+
+// open loads the config the server would use and opens its task store.
+func (f *storeFlags) open(ctx context.Context, stderr io.Writer) (task.TaskStore, config.Config, error) {
+	path := f.configPath
+	if path == "" {
+		path = defaultConfigPath
+		if envPath, ok := os.LookupEnv(configPathEnv); ok && envPath != "" {
+			path = envPath
+		}
+	}
+	cfg, _, err := config.Loader{Path: path, LookupEnv: os.LookupEnv}.Load()
+	if err != nil {
+		return nil, cfg, fmt.Errorf("load config: %w", err)
+	}
+	if f.dataDir != "" {
+		cfg.DataDir = f.dataDir
+	}
+	if f.exclusive {
+		lock, err := task.LockDataDir(cfg.DataDir, true)
+		if err != nil {
+			if errors.Is(err, task.ErrDataDirInUse) {
+				return nil, cfg, fmt.Errorf("%w; stop the server first", err)
+			}
+			return nil, cfg, fmt.Errorf("lock data dir: %w", err)
+		}
+		f.lock = lock
+	}
+	pending, err := task.JournalPending(cfg.DataDir)
+	switch {
+	case err != nil:
+		f.unlock()
+		return nil, cfg, fmt.Errorf("check journal: %w", err)
+	case pending && f.exclusive:
+		f.unlock()
+		return nil, cfg, fmt.Errorf("%w; start and stop the server to fold them into the store first", task.ErrJournalPending)
+	case pending:
+		fmt.Fprintln(stderr, "warning: the journal has uncompacted events; start and stop the server to fold them into the store")
+	}
+	store, err := task.OpenStore(ctx, task.StoreOptions{
+		Driver:         cfg.Store.Driver,
+		DataDir:        cfg.DataDir,
+		Path:           cfg.Store.Path,
+		ReservationTTL: cfg.Cluster.LeaseTTL,
+		ReadOnly:       !f.exclusive,
+	})
+	if err != nil {
+		f.unlock()
+		if errors.Is(err, task.ErrDataDirInUse) {
+			return nil, cfg, fmt.Errorf("open store: %w; stop the server or use the HTTP API", err)
+		}
+		return nil, cfg, fmt.Errorf("open store: %w", err)
+	}
+	return store, cfg, nil
+}
+
+func (f *storeFlags) unlock() {
+	if f.lock != nil {
+		_ = f.lock.Unlock()
+		f.lock = nil
+	}
+}
+
+func runStoreCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, storeUsage)
+		return 2
+	}
+	var run func(context.Context, []string, io.Writer, io.Writer) int
+	switch args[0] {
+	case "ls":
+		run = storeLs
+	case "show":
+		run = storeShow
+	case "fsck":
+		run = storeFsck
+	case "purge":
+		run = storePurge
+	case "export":
+		run = storeExport
+	case "import":
+		run = storeImport
+	default:
+		fmt.Fprintf(stderr, "unknown store command %q\n\n%s", args[0], storeUsage)
+		return 2
+	}
+	return run(context.Background(), args[1:], stdout, stderr)
+}
+
+func newStoreFlagSet(name string, stderr io.Writer) (*flag.FlagSet, *storeFlags) {
+	fs := flag.NewFlagSet("workmate store "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	common := &storeFlags{}
+	common.register(fs)
+	return fs, common
+}
+
+// withStore opens the store, runs fn and closes the store again.
+func withStore(ctx context.Context, common *storeFlags, stderr io.Writer, fn func(task.TaskStore, config.Config) int) int {
+	store, cfg, err := common.open(ctx, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Fprintf(stderr, "close store: %v\n", err)
+		}
+		common.unlock()
+	}()
+	return fn(store, cfg)
+}
+
+func storeLs(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs, common := newStoreFlagSet("ls", stderr)
+	status := fs.String("status", "", "only tasks in this status")
+	since := fs.String("since", "", "only tasks created at or after this RFC3339 time")
+	until := fs.String("until", "", "only tasks created before this RFC3339 time")
+	limit := fs.Int("limit", 0, "maximum number of tasks (0 = all)")
+	asJSON := fs.Bool("json", false, "print JSON lines instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	q := task.Query{Status: task.Status(*status), Limit: *limit}
+	var err error
+	if q.Since, err = parseOptionalTime(*since); err != nil {
+		fmt.Fprintf(stderr, "-since: %v\n", err)
+		return 2
+	}
+	if q.Until, err = parseOptionalTime(*until); err != nil {
+		fmt.Fprintf(stderr, "-until: %v\n", err)
+		return 2
+	}
+
+	return withStore(ctx, common, stderr, func(store task.TaskStore, _ config.Config) int {
+		tasks, err := store.QueryTasks(ctx, q)
+		if err != nil {
+			fmt.Fprintf(stderr, "query tasks: %v\n", err)
+			return 1
+		}
+		if *asJSON {
+			enc := json.NewEncoder(stdout)
+			for _, t := range tasks {
+				if err := enc.Encode(t); err != nil {
+					fmt.Fprintln(stderr, err)
+					return 1
+				}
+			}
+			return 0
+		}
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTATUS\tFILES\tCREATED")
+		for _, t := range tasks {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", t.ID, t.Status, len(t.Files), t.CreatedAt.UTC().Format(time.RFC3339))
+		}
+		if err := tw.Flush(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	})
+}
+
+func storeShow(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs, common := newStoreFlagSet("show", stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprint(stderr, storeUsage)
+		return 2
+	}
+	id := fs.Arg(0)
+
+	return withStore(ctx, common, stderr, func(store task.TaskStore, _ config.Config) int {
+		t, err := store.LoadTask(ctx, id)
+		if errors.Is(err, task.ErrTaskNotFound) {
+			fmt.Fprintf(stderr, "task %s not found\n", id)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "load task: %v\n", err)
+			return 1
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(t); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	})
+}
+
+func storeFsck(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs, common := newStoreFlagSet("fsck", stderr)
+	fix := fs.Bool("fix", false, "repair the problems that can be repaired")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	common.exclusive = *fix
+
+	return withStore(ctx, common, stderr, func(store task.TaskStore, cfg config.Config) int {
+		archives, err := openArchiveStorage(cfg, store)
+		if err != nil {
+			fmt.Fprintf(stderr, "archive storage: %v\n", err)
+			return 1
+		}
+		findings, err := task.Fsck(ctx, store, archives, cfg.DataDir, *fix)
+		for _, f := range findings {
+			line := fmt.Sprintf("%s\t%s\t%s", f.Problem, f.TaskID, f.Path)
+			if f.Detail != "" {
+				line += "\t" + f.Detail
+			}
+			switch {
+			case f.Fixed:
+				line += "\tfixed"
+			case f.FixErr != "":
+				line += "\tfix failed: " + f.FixErr
+			}
+			fmt.Fprintln(stdout, line)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "fsck: %v\n", err)
+			return 1
+		}
+		unresolved := 0
+		for _, f := range findings {
+			if !f.Fixed {
+				unresolved++
+			}
+		}
+		fmt.Fprintf(stdout, "%d problem(s) found, %d unresolved\n", len(findings), unresolved)
+		if unresolved > 0 {
+			return 1
+		}
+		return 0
+	})
+}
+
+func storePurge(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs, common := newStoreFlagSet("purge", stderr)
+	olderThan := fs.String("older-than", "", "delete tasks created longer ago than this (e.g. 72h, 30d)")
+	status := fs.String("status", "", "only tasks in this status")
+	dryRun := fs.Bool("dry-run", false, "list the tasks without deleting them")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	age, err := parseAge(*olderThan)
+	if err != nil {
+		fmt.Fprintf(stderr, "-older-than: %v\n", err)
+		return 2
+	}
+	common.exclusive = !*dryRun
+
+	return withStore(ctx, common, stderr, func(store task.TaskStore, cfg config.Config) int {
+		archives, err := openArchiveStorage(cfg, store)
+		if err != nil {
+			fmt.Fprintf(stderr, "archive storage: %v\n", err)
+			return 1
+		}
+		tasks, err := store.QueryTasks(ctx, task.Query{Status: task.Status(*status), Until: time.Now().Add(-age)})
+		if err != nil {
+			fmt.Fprintf(stderr, "query tasks: %v\n", err)
+			return 1
+		}
+		var auditLog *audit.Log
+		if !*dryRun {
+			if auditLog, err = openAuditLog(cfg); err != nil {
+				fmt.Fprintf(stderr, "audit log: %v\n", err)
+				return 1
+			}
+			defer func() { _ = auditLog.Close() }()
+		}
+		record := func(t *task.Task, err error) {
+			entry := audit.Entry{Actor: cliActor(), Channel: "cli", Action: "archive.purge", TaskID: t.ID, Detail: "status=" + string(t.Status)}
+			if err != nil {
+				entry.Outcome = audit.OutcomeFailure
+				entry.Detail += " error=" + err.Error()
+			}
+			if err := auditLog.Record(entry); err != nil {
+				fmt.Fprintf(stderr, "audit %s: %v\n", t.ID, err)
+			}
+		}
+		failed := 0
+		for _, t := range tasks {
+			if t.Status == task.StatusInProgress {
+				fmt.Fprintf(stderr, "skip %s: in progress\n", t.ID)
+				continue
+			}
+			if *dryRun {
+				fmt.Fprintf(stdout, "would delete %s (%s, created %s)\n", t.ID, t.Status, t.CreatedAt.UTC().Format(time.RFC3339))
+				continue
+			}
+			if err := archives.Delete(ctx, t.ID); err != nil {
+				fmt.Fprintf(stderr, "delete archive of %s: %v\n", t.ID, err)
+				record(t, err)
+				failed++
+				continue
+			}
+			if err := store.DeleteTask(ctx, t.ID); err != nil {
+				fmt.Fprintf(stderr, "delete %s: %v\n", t.ID, err)
+				record(t, err)
+				failed++
+				continue
+			}
+			record(t, nil)
+			if err := task.RemoveClusterFiles(cfg.DataDir, t.ID); err != nil {
+				fmt.Fprintf(stderr, "remove cluster files of %s: %v\n", t.ID, err)
+			}
+			fmt.Fprintf(stdout, "deleted %s\n", t.ID)
+		}
+		if failed > 0 {
+			return 1
+		}
+		return 0
+	})
+}
+
+func storeExport(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs, common := newStoreFlagSet("export", stderr)
+	output := fs.String("o", "", "output file (- for stdout)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *output == "" {
+		fmt.Fprint(stderr, storeUsage)
+		return 2
+	}
+
+	return withStore(ctx, common, stderr, func(store task.TaskStore, _ config.Config) int {
+		w := stdout
+		if *output != "-" {
+			f, err := os.Create(*output)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			defer func() { _ = f.Close() }()
+			w = f
+		}
+		n, err := task.ExportTasks(ctx, store, w)
+		if err != nil {
+			fmt.Fprintf(stderr, "export: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(stderr, "exported %d task(s)\n", n)
+		return 0
+	})
+}
+
+func storeImport(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs, common := newStoreFlagSet("import", stderr)
+	overwrite := fs.Bool("overwrite", false, "replace tasks that already exist")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprint(stderr, storeUsage)
+		return 2
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer func() { _ = f.Close() }()
+	common.exclusive = true
+
+	return withStore(ctx, common, stderr, func(store task.TaskStore, _ config.Config) int {
+		result, err := task.ImportTasks(ctx, store, f, *overwrite)
+		for _, id := range result.Skipped {
+			fmt.Fprintf(stdout, "skipped %s: already exists\n", id)
+		}
+		for _, failed := range result.Failed {
+			fmt.Fprintf(stdout, "failed %s: %s\n", failed.TaskID, failed.Reason)
+		}
+		fmt.Fprintf(stdout, "imported %d task(s), skipped %d, failed %d\n", len(result.Imported), len(result.Skipped), len(result.Failed))
+		if err != nil {
+			fmt.Fprintf(stderr, "import: %v\n", err)
+			return 1
+		}
+		if len(result.Failed) > 0 {
+			return 1
+		}
+		return 0
+	})
+}
+
+// cliActor names the local user running a store command in audit entries.
+func cliActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "user:" + u.Username
+	}
+	return "cli"
+}
+
+func parseOptionalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseAge accepts time.ParseDuration syntax plus a whole-day "Nd" form.
+func parseAge(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, errors.New("required")
+	}
+	var age time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid day count %q", value)
+		}
+		age = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if age, err = time.ParseDuration(value); err != nil {
+			return 0, err
+		}
+	}
+	if age <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	return age, nil
+}
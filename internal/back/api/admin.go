@@ -0,0 +1,206 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"workmate/internal/back/audit"
+	"workmate/internal/back/problem"
+	"workmate/internal/back/reload"
+	"workmate/internal/back/task"
+)
+
+type drainRequest struct {
+	Reason string `json:"reason"`
+}
+
+type concurrencyRequest struct {
+	MaxConcurrentTasks int `json:"max_concurrent_tasks"`
+}
+
+type workerResponse struct {
+	TaskID         string  `json:"task_id"`
+	StartedAt      string  `json:"started_at"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+type adminStatusResponse struct {
+	Draining           bool             `json:"draining"`
+	DrainReason        string           `json:"drain_reason,omitempty"`
+	Paused             bool             `json:"paused"`
+	MaxConcurrentTasks int              `json:"max_concurrent_tasks"`
+	SlotsInUse         int              `json:"slots_in_use"`
+	Workers            []workerResponse `json:"workers"`
+}
+
+type Admin struct {
+	taskManager *task.Manager
+	token       string
+	reloader    *reload.Reloader
+	audit       *audit.Log
+}
+
+func NewAdmin(taskManager *task.Manager, token string) *Admin {
+	return &Admin{taskManager: taskManager, token: token}
+}
+
+func (a *Admin) UseReloader(reloader *reload.Reloader) {
+	a.reloader = reloader
+}
+
+func (a *Admin) UseAudit(auditLog *audit.Log) {
+	a.audit = auditLog
+}
+
+func (a *Admin) RegisterRoutes(router *gin.Engine) {
+	if a.token == "" {
+		log.Warn().Msg("admin token is not configured, admin endpoints are disabled")
+		return
+	}
+	admin := router.Group("/api/v1/admin", AdminAuth(a.token))
+	{
+		admin.GET("/status", a.Status)
+		admin.GET("/workers", a.Workers)
+		admin.POST("/drain", a.StartDrain)
+		admin.DELETE("/drain", a.StopDrain)
+		admin.POST("/pause", a.Pause)
+		admin.POST("/resume", a.Resume)
+		admin.PUT("/concurrency", a.SetConcurrency)
+		admin.GET("/quarantine", a.Quarantine)
+		if a.reloader != nil {
+			admin.POST("/config/reload", a.ReloadConfig)
+			admin.GET("/config/reloads", a.ConfigReloads)
+		}
+		if a.audit != nil {
+			admin.GET("/audit", a.AuditEntries)
+		}
+	}
+}
+
+func AdminAuth(token string) gin.HandlerFunc {
+	expected := []byte(token)
+	return func(c *gin.Context) {
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), expected) != 1 {
+			reqLog(c).Warn().Str("path", c.Request.URL.Path).Str("ip", c.ClientIP()).Msg("rejected admin request")
+			c.Header("WWW-Authenticate", `Bearer realm="workmate-admin"`)
+			writeProblem(c, problem.ErrUnauthorized)
+			c.Abort()
+			return
+		}
+		c.Set(audit.ActorKey, "admin")
+		c.Next()
+	}
+}
+
+func (a *Admin) Status(c *gin.Context) {
+	c.JSON(http.StatusOK, a.statusResponse())
+}
+
+func (a *Admin) Workers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"workers": workersResponse(a.taskManager.InFlight())})
+}
+
+func (a *Admin) StartDrain(c *gin.Context) {
+	var req drainRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeProblem(c, problem.ErrInvalidRequest)
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		reason = "maintenance"
+	}
+	a.taskManager.Drain(reason)
+	reqLog(c).Info().Str("reason", reason).Msg("drain mode enabled")
+	c.JSON(http.StatusOK, a.statusResponse())
+}
+
+func (a *Admin) StopDrain(c *gin.Context) {
+	a.taskManager.StopDraining()
+	reqLog(c).Info().Msg("drain mode disabled")
+	c.JSON(http.StatusOK, a.statusResponse())
+}
+
+func (a *Admin) Pause(c *gin.Context) {
+	a.taskManager.Pause()
+	reqLog(c).Info().Msg("processing paused")
+	c.JSON(http.StatusOK, a.statusResponse())
+}
+
+func (a *Admin) Resume(c *gin.Context) {
+	a.taskManager.Resume()
+	reqLog(c).Info().Msg("processing resumed")
+	c.JSON(http.StatusOK, a.statusResponse())
+}
+
+func (a *Admin) SetConcurrency(c *gin.Context) {
+	var req concurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.MaxConcurrentTasks < 1 {
+		writeProblem(c, problem.ErrInvalidRequest)
+		return
+	}
+	if err := a.taskManager.SetMaxConcurrentTasks(req.MaxConcurrentTasks); err != nil {
+		writeProblem(c, problem.ErrInvalidRequest)
+		return
+	}
+	reqLog(c).Info().Int("max_concurrent_tasks", req.MaxConcurrentTasks).Msg("concurrency limit changed")
+	c.JSON(http.StatusOK, a.statusResponse())
+}
+
+func (a *Admin) Quarantine(c *gin.Context) {
+	records, err := a.taskManager.Quarantined()
+	if err != nil {
+		reqLog(c).Error().Err(err).Msg("list quarantine failed")
+		writeProblem(c, err)
+		return
+	}
+	if records == nil {
+		records = []task.QuarantinedRecord{}
+	}
+	c.JSON(http.StatusOK, gin.H{"records": records, "last_load": a.taskManager.LoadReport()})
+}
+
+func (a *Admin) ReloadConfig(c *gin.Context) {
+	result := a.reloader.Reload(reload.SourceAdmin)
+	if !result.OK {
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (a *Admin) ConfigReloads(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"reloads": a.reloader.History()})
+}
+
+func (a *Admin) statusResponse() adminStatusResponse {
+	state := a.taskManager.ProcessingState()
+	return adminStatusResponse{
+		Draining:           state.Draining,
+		DrainReason:        state.DrainReason,
+		Paused:             state.Paused,
+		MaxConcurrentTasks: state.MaxConcurrentTasks,
+		SlotsInUse:         state.SlotsInUse,
+		Workers:            workersResponse(state.Workers),
+	}
+}
+
+func workersResponse(workers []task.Worker) []workerResponse {
+	now := time.Now()
+	out := make([]workerResponse, 0, len(workers))
+	for _, w := range workers {
+		out = append(out, workerResponse{
+			TaskID:         w.TaskID,
+			StartedAt:      w.StartedAt.Format(time.RFC3339),
+			ElapsedSeconds: now.Sub(w.StartedAt).Seconds(),
+		})
+	}
+	return out
+}
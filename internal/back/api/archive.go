@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"workmate/internal/back/archive"
+	"workmate/internal/back/problem"
+)
+
+const sniffLen = 512
+
+// inlineContentTypes can be previewed in the browser without running script.
+// Anything else, HTML and SVG included, is sent as an octet-stream attachment
+// so a downloaded file cannot execute in the service's origin.
+var inlineContentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/gif":       true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"text/plain":      true,
+}
+
+type archiveEntryResponse struct {
+	Name             string  `json:"name"`
+	Size             uint64  `json:"size"`
+	CompressedSize   uint64  `json:"compressed_size"`
+	CRC32            string  `json:"crc32"`
+	Method           string  `json:"method"`
+	CompressionRatio float64 `json:"compression_ratio"`
+	Modified         string  `json:"modified,omitempty"`
+}
+
+type archiveEntriesResponse struct {
+	TaskID              string                 `json:"task_id"`
+	Entries             []archiveEntryResponse `json:"entries"`
+	TotalSize           uint64                 `json:"total_size"`
+	TotalCompressedSize uint64                 `json:"total_compressed_size"`
+}
+
+func (a *API) ArchiveEntries(c *gin.Context) {
+	id := c.Param("id")
+	archivePath, err := a.taskManager.ReadyArchivePath(c.Request.Context(), id)
+	if err != nil {
+		reqLog(c).Warn().Str("task_id", id).Err(err).Msg("cannot list archive entries")
+		writeProblem(c, err)
+		return
+	}
+	entries, err := archive.ListEntries(archivePath)
+	if err != nil {
+		reqLog(c).Error().Str("task_id", id).Err(err).Msg("list archive entries failed")
+		writeProblem(c, err)
+		return
+	}
+
+	resp := archiveEntriesResponse{TaskID: id, Entries: make([]archiveEntryResponse, 0, len(entries))}
+	for _, e := range entries {
+		entryResp := archiveEntryResponse{
+			Name:             e.Name,
+			Size:             e.Size,
+			CompressedSize:   e.CompressedSize,
+			CRC32:            fmt.Sprintf("%08x", e.CRC32),
+			Method:           e.Method,
+			CompressionRatio: e.CompressionRatio,
+		}
+		if !e.Modified.IsZero() {
+			entryResp.Modified = e.Modified.UTC().Format(time.RFC3339)
+		}
+		resp.Entries = append(resp.Entries, entryResp)
+		resp.TotalSize += e.Size
+		resp.TotalCompressedSize += e.CompressedSize
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (a *API) FileContent(c *gin.Context) {
+	id := c.Param("id")
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		writeProblem(c, problem.ErrInvalidRequest)
+		return
+	}
+	archivePath, filename, err := a.taskManager.ArchivedFile(c.Request.Context(), id, index)
+	if err != nil {
+		reqLog(c).Warn().Str("task_id", id).Int("index", index).Err(err).Msg("file content not available")
+		writeProblem(c, err)
+		return
+	}
+	entryReader, entry, err := archive.OpenEntry(archivePath, filename)
+	if err != nil {
+		reqLog(c).Error().Str("task_id", id).Str("entry", filename).Err(err).Msg("open archive entry failed")
+		writeProblem(c, err)
+		return
+	}
+	defer func() { _ = entryReader.Close() }()
+
+	bodyReader := bufio.NewReaderSize(entryReader, sniffLen)
+	contentType := mime.TypeByExtension(strings.ToLower(path.Ext(entry.Name)))
+	if contentType == "" {
+		head, _ := bodyReader.Peek(sniffLen)
+		contentType = http.DetectContentType(head)
+	}
+	disposition := "inline"
+	if mediaType, _, _ := mime.ParseMediaType(contentType); !inlineContentTypes[mediaType] {
+		contentType = "application/octet-stream"
+		disposition = "attachment"
+	}
+	headers := map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": entry.Name}),
+		"X-Content-Type-Options": "nosniff",
+	}
+	reqLog(c).Info().Str("task_id", id).Str("entry", entry.Name).Msg("serving archived file")
+	c.DataFromReader(http.StatusOK, int64(entry.Size), contentType, bodyReader, headers)
+}
+
+// archiveETag is a strong validator derived from the archive content, or ""
+// when no checksum was recorded.
+func archiveETag(sha256Hex string) string {
+	if sha256Hex == "" {
+		return ""
+	}
+	return `"` + sha256Hex + `"`
+}
+
+// etagMatch applies the weak comparison If-None-Match uses.
+func etagMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setArchiveDigest sends the archive checksum both as Repr-Digest (RFC 9530)
+// and as the older Digest header (RFC 3230) many clients still check.
+func setArchiveDigest(c *gin.Context, sha256Hex string) {
+	sum, err := hex.DecodeString(sha256Hex)
+	if err != nil {
+		return
+	}
+	encoded := base64.StdEncoding.EncodeToString(sum)
+	c.Header("Repr-Digest", "sha-256=:"+encoded+":")
+	c.Header("Digest", "SHA-256="+encoded)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"workmate/internal/back/audit"
+	"workmate/internal/back/logging"
+	"workmate/internal/back/problem"
+)
+
+// auditActions names the routes that are recorded in the audit log. Any other
+// mutating route is recorded under its method and route pattern.
+var auditActions = map[string]string{
+	"POST /api/v1/tasks":                         "task.create",
+	"POST /api/v1/tasks/:id/files":               "task.add_files",
+	"POST /api/v1/tasks/:id/uploads":             "task.upload_files",
+	"PUT /api/v1/tasks/:id/files/:index":         "task.replace_file",
+	"DELETE /api/v1/tasks/:id/files/:index":      "task.remove_file",
+	"GET /api/v1/tasks/:id/archive":              "archive.download",
+	"GET /api/v1/tasks/:id/files/:index/content": "archive.download_file",
+	"POST /ui/tasks":                             "task.create",
+	"POST /ui/tasks/:id/files":                   "task.add_files",
+	"POST /ui/tasks/:id/uploads":                 "task.upload_files",
+	"POST /ui/tasks/:id/files/:index":            "task.replace_file",
+	"POST /ui/tasks/:id/files/:index/delete":     "task.remove_file",
+	"POST /api/v1/admin/drain":                   "admin.drain",
+	"DELETE /api/v1/admin/drain":                 "admin.stop_draining",
+	"POST /api/v1/admin/pause":                   "admin.pause",
+	"POST /api/v1/admin/resume":                  "admin.resume",
+	"PUT /api/v1/admin/concurrency":              "admin.set_concurrency",
+	"POST /api/v1/admin/config/reload":           "admin.config_reload",
+}
+
+// Audit records every mutating request and every archive download once the
+// handler has finished, so the outcome reflects the final response status.
+func Audit(auditLog *audit.Log) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			return
+		}
+		action, known := auditActions[c.Request.Method+" "+route]
+		if !known {
+			if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+				return
+			}
+			action = strings.ToLower(c.Request.Method) + " " + route
+		}
+
+		entry := audit.Entry{
+			RequestID: logging.RequestIDFromContext(c.Request.Context()),
+			Actor:     c.GetString(audit.ActorKey),
+			Channel:   auditChannel(route),
+			Action:    action,
+			TaskID:    c.GetString(audit.TaskIDKey),
+			Status:    c.Writer.Status(),
+			Outcome:   audit.OutcomeSuccess,
+		}
+		if entry.Actor == "" {
+			entry.Actor = "ip:" + c.ClientIP()
+		}
+		if entry.TaskID == "" {
+			entry.TaskID = c.Param("id")
+		}
+		if index := c.Param("index"); index != "" {
+			entry.Detail = "index=" + index
+		}
+		if entry.Status >= statusWarnThreshold {
+			entry.Outcome = audit.OutcomeFailure
+		}
+		if err := auditLog.Record(entry); err != nil {
+			reqLog(c).Error().Err(err).Str("action", action).Msg("audit record failed")
+		}
+	}
+}
+
+func auditChannel(route string) string {
+	switch {
+	case strings.HasPrefix(route, "/api/v1/admin"):
+		return "admin"
+	case strings.HasPrefix(route, "/ui"):
+		return "ui"
+	default:
+		return "api"
+	}
+}
+
+func (a *Admin) AuditEntries(c *gin.Context) {
+	filter := audit.Filter{TaskID: strings.TrimSpace(c.Query("task_id"))}
+	var err error
+	if filter.Since, err = parseAuditTime(c.Query("since")); err != nil {
+		writeProblem(c, problem.ErrInvalidRequest)
+		return
+	}
+	if filter.Until, err = parseAuditTime(c.Query("until")); err != nil {
+		writeProblem(c, problem.ErrInvalidRequest)
+		return
+	}
+	if raw := c.Query("limit"); raw != "" {
+		if filter.Limit, err = strconv.Atoi(raw); err != nil || filter.Limit < 1 || filter.Limit > audit.MaxLimit {
+			writeProblem(c, problem.ErrInvalidRequest)
+			return
+		}
+	}
+
+	entries, truncated, err := a.audit.Query(filter)
+	if err != nil {
+		reqLog(c).Error().Err(err).Msg("audit query failed")
+		writeProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "truncated": truncated})
+}
+
+func parseAuditTime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
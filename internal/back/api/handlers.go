@@ -1,36 +1,65 @@
 package api
 
 import (
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
 
+	"workmate/internal/back/audit"
+	"workmate/internal/back/logging"
+	"workmate/internal/back/problem"
+	"workmate/internal/back/storage"
 	"workmate/internal/back/task"
 )
 
+var log = logging.Package("api")
+
+type createTaskRequest struct {
+	URLs        []string `json:"urls"`
+	Title       string   `json:"title"`
+	Format      string   `json:"format"`
+	Compression string   `json:"compression"`
+}
+
 type createTaskResponse struct {
-	TaskID string      `json:"task_id"`
-	Status task.Status `json:"status"`
-	Title  string      `json:"title"`
+	TaskID     string         `json:"task_id"`
+	Status     task.Status    `json:"status"`
+	Title      string         `json:"title"`
+	Files      []task.FileRef `json:"files,omitempty"`
+	ArchiveURL string         `json:"archive_url,omitempty"`
 }
 
 type addFilesRequest struct {
 	URLs []string `json:"urls"`
 }
 
+type replaceFileRequest struct {
+	URL string `json:"url"`
+}
+
 type taskResponse struct {
-	ID         string         `json:"id"`
-	Status     task.Status    `json:"status"`
-	CreatedAt  string         `json:"created_at"`
-	Title      string         `json:"title"`
-	Files      []task.FileRef `json:"files"`
-	ArchiveURL string         `json:"archive_url,omitempty"`
+	ID             string         `json:"id"`
+	Status         task.Status    `json:"status"`
+	CreatedAt      string         `json:"created_at"`
+	Title          string         `json:"title"`
+	Files          []task.FileRef `json:"files"`
+	RemainingSlots int            `json:"remaining_slots"`
+	ArchiveURL     string         `json:"archive_url,omitempty"`
+	RequestID      string         `json:"request_id,omitempty"`
+	ExpiredAt      string         `json:"expired_at,omitempty"`
+	ArchiveSHA256  string         `json:"archive_sha256,omitempty"`
+	ArchiveSize    int64          `json:"archive_size,omitempty"`
 }
 
 type API struct {
 	taskManager *task.Manager
+	// presignTTL enables redirecting archive downloads to presigned urls.
+	presignTTL time.Duration
 }
 
 const archiveURLFilesThreshold = 3
@@ -39,47 +68,126 @@ func NewAPI(taskManager *task.Manager) *API {
 	return &API{taskManager: taskManager}
 }
 
+// UseArchiveRedirect makes DownloadArchive redirect to a presigned storage
+// url valid for ttl instead of proxying the archive. Storage without
+// presigning support keeps proxying.
+func (a *API) UseArchiveRedirect(ttl time.Duration) {
+	a.presignTTL = ttl
+}
+
 func (a *API) RegisterRoutes(router *gin.Engine) {
 	api := router.Group("/api/v1")
 	{
 		api.POST("/tasks", a.CreateTask)
 		api.POST("/tasks/:id/files", a.AddFiles)
+		api.POST("/tasks/:id/uploads", a.UploadFiles)
+		api.PUT("/tasks/:id/files/:index", a.ReplaceFile)
+		api.DELETE("/tasks/:id/files/:index", a.RemoveFile)
 		api.GET("/tasks/:id", a.GetTask)
+		api.GET("/tasks/:id/files/:index/content", a.FileContent)
 		api.GET("/tasks/:id/archive", a.DownloadArchive)
+		api.HEAD("/tasks/:id/archive", a.DownloadArchive)
+		api.GET("/tasks/:id/archive/entries", a.ArchiveEntries)
 	}
 }
 
 func (a *API) CreateTask(c *gin.Context) {
-	if a.taskManager.IsBusy() {
-		log.Warn().Msg("rejecting task creation: server is at max concurrency")
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "server busy"})
+	var req createTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		reqLog(c).Warn().Err(err).Msg("invalid create task request")
+		writeProblem(c, problem.ErrInvalidRequest)
 		return
 	}
-	createdTask := a.taskManager.CreateTask()
-	log.Info().Str("task_id", createdTask.ID).Time("created_at", createdTask.CreatedAt).Msg("task created")
-	c.JSON(http.StatusCreated, createTaskResponse{TaskID: createdTask.ID, Status: createdTask.Status, Title: createdTask.Title})
+
+	createdTask, err := a.taskManager.CreateTaskWithOptions(c.Request.Context(), task.CreateOptions{
+		URLs:        req.URLs,
+		Title:       req.Title,
+		Format:      task.ArchiveFormat(req.Format),
+		Compression: task.Compression(req.Compression),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, task.ErrBusy):
+			reqLog(c).Warn().Msg("rejecting task creation: server is at max concurrency")
+		case errors.Is(err, task.ErrDraining):
+			reqLog(c).Warn().Err(err).Msg("rejecting task creation: server is draining")
+		case problem.FromError(err).Status >= http.StatusInternalServerError:
+			reqLog(c).Error().Err(err).Msg("failed to create task")
+		default:
+			reqLog(c).Warn().Err(err).Msg("rejecting task creation: invalid options")
+		}
+		writeProblem(c, err)
+		return
+	}
+	c.Set(audit.TaskIDKey, createdTask.ID)
+	reqLog(c).Info().Str("task_id", createdTask.ID).Time("created_at", createdTask.CreatedAt).Int("files_total", len(createdTask.Files)).Msg("task created")
+
+	resp := createTaskResponse{TaskID: createdTask.ID, Status: createdTask.Status, Title: createdTask.Title, Files: createdTask.Files}
+	if len(createdTask.Files) >= archiveURLFilesThreshold {
+		resp.ArchiveURL = archiveURL(createdTask.ID)
+	}
+	c.JSON(http.StatusCreated, resp)
 }
 
 func (a *API) AddFiles(c *gin.Context) {
 	id := c.Param("id")
 	var req addFilesRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Warn().Str("task_id", id).Err(err).Msg("invalid add files request")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		reqLog(c).Warn().Str("task_id", id).Err(err).Msg("invalid add files request")
+		writeProblem(c, problem.ErrInvalidRequest)
 		return
 	}
-	currentTask, err := a.taskManager.AddFiles(id, req.URLs)
+	currentTask, err := a.taskManager.AddFilesContext(c.Request.Context(), id, req.URLs)
 	if err != nil {
-		if err.Error() == "task not found" {
-			log.Warn().Str("task_id", id).Msg("task not found on add files")
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
+		if errors.Is(err, task.ErrTaskNotFound) {
+			reqLog(c).Warn().Str("task_id", id).Msg("task not found on add files")
+		} else {
+			reqLog(c).Warn().Str("task_id", id).Err(err).Msg("failed to add files")
 		}
-		log.Warn().Str("task_id", id).Err(err).Msg("failed to add files")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeProblem(c, err)
 		return
 	}
-	log.Info().Str("task_id", currentTask.ID).Int("files_total", len(currentTask.Files)).Msg("files added to task")
+	reqLog(c).Info().Str("task_id", currentTask.ID).Int("files_total", len(currentTask.Files)).Msg("files added to task")
+	c.JSON(http.StatusOK, a.toTaskResponse(currentTask, c))
+}
+
+func (a *API) ReplaceFile(c *gin.Context) {
+	id := c.Param("id")
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		writeProblem(c, problem.ErrInvalidRequest)
+		return
+	}
+	var req replaceFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		reqLog(c).Warn().Str("task_id", id).Err(err).Msg("invalid replace file request")
+		writeProblem(c, problem.ErrInvalidRequest)
+		return
+	}
+	currentTask, err := a.taskManager.ReplaceFile(id, index, req.URL)
+	if err != nil {
+		reqLog(c).Warn().Str("task_id", id).Int("index", index).Err(err).Msg("failed to replace file")
+		writeProblem(c, err)
+		return
+	}
+	reqLog(c).Info().Str("task_id", id).Int("index", index).Msg("file replaced in task")
+	c.JSON(http.StatusOK, a.toTaskResponse(currentTask, c))
+}
+
+func (a *API) RemoveFile(c *gin.Context) {
+	id := c.Param("id")
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		writeProblem(c, problem.ErrInvalidRequest)
+		return
+	}
+	currentTask, err := a.taskManager.RemoveFile(id, index)
+	if err != nil {
+		reqLog(c).Warn().Str("task_id", id).Int("index", index).Err(err).Msg("failed to remove file")
+		writeProblem(c, err)
+		return
+	}
+	reqLog(c).Info().Str("task_id", id).Int("index", index).Int("files_total", len(currentTask.Files)).Msg("file removed from task")
 	c.JSON(http.StatusOK, a.toTaskResponse(currentTask, c))
 }
 
@@ -89,38 +197,104 @@ func (a *API) GetTask(c *gin.Context) {
 		c.JSON(http.StatusOK, a.toTaskResponse(foundTask, c))
 		return
 	}
-	log.Warn().Str("task_id", id).Msg("task not found on get")
-	c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+	reqLog(c).Warn().Str("task_id", id).Msg("task not found on get")
+	writeProblem(c, task.ErrTaskNotFound)
 }
 
 func (a *API) DownloadArchive(c *gin.Context) {
 	id := c.Param("id")
 	foundTask, ok := a.taskManager.GetTask(id)
 	if !ok {
-		log.Warn().Str("task_id", id).Msg("task not found on download")
-		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		reqLog(c).Warn().Str("task_id", id).Msg("task not found on download")
+		writeProblem(c, task.ErrTaskNotFound)
+		return
+	}
+	if foundTask.Status == task.StatusExpired {
+		reqLog(c).Info().Str("task_id", id).Msg("download of expired archive")
+		writeProblem(c, task.ErrArchiveExpired)
 		return
 	}
 	if foundTask.Status != task.StatusReady || foundTask.ArchivePath == "" {
-		log.Warn().Str("task_id", id).Str("status", string(foundTask.Status)).Msg("archive not ready to download")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "archive not ready"})
+		reqLog(c).Warn().Str("task_id", id).Str("status", string(foundTask.Status)).Msg("archive not ready to download")
+		writeProblem(c, task.ErrArchiveNotReady)
 		return
 	}
-	log.Info().Str("task_id", id).Str("path", foundTask.ArchivePath).Msg("serving archive download")
-	c.FileAttachment(foundTask.ArchivePath, "archive-"+foundTask.ID+".zip")
+	filename := "archive-" + foundTask.ID + ".zip"
+	etag := archiveETag(foundTask.ArchiveSHA256)
+	isGet := c.Request.Method == http.MethodGet
+	archives := a.taskManager.Archives()
+	if a.presignTTL > 0 {
+		if etag != "" && etagMatch(c.GetHeader("If-None-Match"), etag) {
+			c.Header("ETag", etag)
+			c.Status(http.StatusNotModified)
+			return
+		}
+		signedURL, err := archives.PresignGet(c.Request.Context(), id, filename, a.presignTTL)
+		switch {
+		case err == nil:
+			reqLog(c).Info().Str("task_id", id).Str("driver", archives.Driver()).Msg("redirecting archive download")
+			if isGet {
+				a.taskManager.MarkDownloaded(c.Request.Context(), id)
+			}
+			// The storage may not echo the checksum, so clients verify the
+			// object they are redirected to against these headers.
+			if etag != "" {
+				c.Header("ETag", etag)
+				setArchiveDigest(c, foundTask.ArchiveSHA256)
+			}
+			c.Redirect(http.StatusFound, signedURL)
+			return
+		case !errors.Is(err, storage.ErrPresignUnsupported):
+			reqLog(c).Error().Str("task_id", id).Err(err).Msg("presign archive download failed")
+			writeProblem(c, err)
+			return
+		}
+	}
+
+	obj, err := archives.Open(c.Request.Context(), id)
+	if err != nil {
+		reqLog(c).Error().Str("task_id", id).Str("driver", archives.Driver()).Err(err).Msg("open archive failed")
+		writeProblem(c, err)
+		return
+	}
+	defer func() { _ = obj.Close() }()
+	reqLog(c).Info().Str("task_id", id).Str("driver", archives.Driver()).Int64("size", obj.Size).Msg("serving archive download")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	// ServeContent answers If-None-Match, If-Range and Range against the
+	// ETag; archives built before checksums were recorded fall back to
+	// Last-Modified.
+	if etag != "" {
+		c.Header("ETag", etag)
+		setArchiveDigest(c, foundTask.ArchiveSHA256)
+	}
+	http.ServeContent(c.Writer, c.Request, filename, obj.ModTime, obj)
+	if status := c.Writer.Status(); isGet && (status == http.StatusOK || status == http.StatusPartialContent) {
+		a.taskManager.MarkDownloaded(c.Request.Context(), id)
+	}
 }
 
 func (a *API) toTaskResponse(taskEntity *task.Task, _ *gin.Context) taskResponse {
 	resp := taskResponse{
-		ID:        taskEntity.ID,
-		Status:    taskEntity.Status,
-		CreatedAt: taskEntity.CreatedAt.UTC().Format(time.RFC3339),
-		Title:     taskEntity.Title,
-		Files:     taskEntity.Files,
+		ID:             taskEntity.ID,
+		Status:         taskEntity.Status,
+		CreatedAt:      taskEntity.CreatedAt.UTC().Format(time.RFC3339),
+		Title:          taskEntity.Title,
+		Files:          taskEntity.Files,
+		RemainingSlots: task.RemainingSlots(taskEntity),
+		RequestID:      taskEntity.RequestID,
+		ArchiveSHA256:  taskEntity.ArchiveSHA256,
+		ArchiveSize:    taskEntity.ArchiveSize,
 	}
 
 	if len(taskEntity.Files) >= archiveURLFilesThreshold {
-		resp.ArchiveURL = "/api/v1/tasks/" + taskEntity.ID + "/archive"
+		resp.ArchiveURL = archiveURL(taskEntity.ID)
+	}
+	if taskEntity.ExpiredAt != nil {
+		resp.ExpiredAt = taskEntity.ExpiredAt.UTC().Format(time.RFC3339)
 	}
 	return resp
 }
+
+func archiveURL(taskID string) string {
+	return "/api/v1/tasks/" + taskID + "/archive"
+}
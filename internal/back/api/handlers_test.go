@@ -2,15 +2,24 @@ package api
 
 import (
 	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"workmate/internal/back/archive"
+	"workmate/internal/back/audit"
+	"workmate/internal/back/storage"
 	"workmate/internal/back/task"
 
 	"context"
@@ -85,6 +94,15 @@ func TestAddThreeFilesTriggersProcessing(t *testing.T) {
 	testManager := task.NewManagerWithOptions(task.Options{DataDir: t.TempDir(), AllowedExtensions: []string{".pdf", ".jpeg"}, MaxConcurrentTasks: 3})
 
 	testManager.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		f, err := os.Create(dest)
+		if err != nil {
+			return nil, err
+		}
+		zw := zip.NewWriter(f)
+		_, _ = zw.Create("f")
+		_ = zw.Close()
+		_ = f.Close()
+
 		results := make([]archive.Result, len(urls))
 		for i := range results {
 			results[i].Filename = "f"
@@ -165,6 +183,16 @@ func TestInvalidExtension(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Fatalf("expected 400, got %d", w.Code)
 	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/problem+json") {
+		t.Fatalf("expected problem+json content type, got %q", ct)
+	}
+	var prob map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &prob); err != nil {
+		t.Fatalf("unmarshal problem: %v", err)
+	}
+	if prob["code"] != "extension_not_allowed" || prob["extension"] != ".exe" || prob["status"] != float64(http.StatusBadRequest) {
+		t.Fatalf("unexpected problem body: %v", prob)
+	}
 }
 
 func TestTooManyFiles(t *testing.T) {
@@ -316,6 +344,83 @@ func TestDownloadArchiveReady(t *testing.T) {
 	}
 }
 
+func TestDownloadArchiveConditionalRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testRouter := gin.Default()
+	testManager := task.NewManagerWithOptions(task.Options{DataDir: t.TempDir(), AllowedExtensions: []string{".pdf"}, MaxConcurrentTasks: 1})
+	testManager.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		f, err := os.Create(dest)
+		if err != nil {
+			return nil, err
+		}
+		zw := zip.NewWriter(f)
+		w, _ := zw.Create("ok.txt")
+		_, _ = w.Write(bytes.Repeat([]byte("workmate "), 100))
+		_ = zw.Close()
+		_ = f.Close()
+		return make([]archive.Result, len(urls)), nil
+	})
+	NewAPI(testManager).RegisterRoutes(testRouter)
+
+	created, err := testManager.CreateTaskWithOptions(context.Background(), task.CreateOptions{URLs: []string{"https://e.org/a.pdf", "https://e.org/b.pdf", "https://e.org/c.pdf"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if tsk, _ := testManager.GetTask(created.ID); tsk.Status == task.StatusReady {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	url := "/api/v1/tasks/" + created.ID + "/archive"
+	do := func(method string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	sum := sha256.Sum256(w.Body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Fatalf("expected ETag %s, got %s", etag, got)
+	}
+	digest := base64.StdEncoding.EncodeToString(sum[:])
+	if got := w.Header().Get("Repr-Digest"); got != "sha-256=:"+digest+":" {
+		t.Fatalf("unexpected Repr-Digest %q", got)
+	}
+	if got := w.Header().Get("Digest"); got != "SHA-256="+digest {
+		t.Fatalf("unexpected Digest %q", got)
+	}
+	full := w.Body.Len()
+
+	if w := do(http.MethodGet, map[string]string{"If-None-Match": `"other", ` + etag}); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("expected 304 for a matching If-None-Match, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+
+	w = do(http.MethodHead, nil)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != strconv.Itoa(full) || w.Header().Get("ETag") != etag {
+		t.Fatalf("unexpected HEAD response %d, body %d bytes, headers %v", w.Code, w.Body.Len(), w.Header())
+	}
+
+	w = do(http.MethodGet, map[string]string{"Range": "bytes=10-19", "If-Range": etag})
+	if w.Code != http.StatusPartialContent || w.Body.Len() != 10 {
+		t.Fatalf("expected a 10 byte 206 for a matching If-Range, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+	w = do(http.MethodGet, map[string]string{"Range": "bytes=10-19", "If-Range": `"stale"`})
+	if w.Code != http.StatusOK || w.Body.Len() != full {
+		t.Fatalf("expected the full archive for a stale If-Range, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+}
+
 func TestServerBusyOnCreate(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	testRouter := gin.Default()
@@ -355,6 +460,600 @@ func TestServerBusyOnCreate(t *testing.T) {
 	if w.Code != http.StatusServiceUnavailable {
 		t.Fatalf("expected 503, got %d", w.Code)
 	}
+	var prob map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &prob)
+	if prob["code"] != "server_busy" {
+		t.Fatalf("expected server_busy code, got %v", prob["code"])
+	}
 
 	close(blocker)
+	testManager.WaitAll(context.Background())
+}
+
+func TestCreateTaskWithBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testRouter := gin.Default()
+	testManager := task.NewManagerWithOptions(task.Options{DataDir: t.TempDir(), AllowedExtensions: []string{".pdf", ".jpeg"}, MaxConcurrentTasks: 3})
+	testManager.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		return make([]archive.Result, len(urls)), nil
+	})
+	apiHandler := NewAPI(testManager)
+	apiHandler.RegisterRoutes(testRouter)
+
+	body := `{"title":"Reports","compression":"store","urls":["https://e.org/a.pdf","https://e.org/b.jpeg","https://e.org/c.pdf"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp["title"] != "Reports" {
+		t.Fatalf("expected custom title, got %v", resp["title"])
+	}
+	if resp["archive_url"] == nil || resp["archive_url"].(string) == "" {
+		t.Fatalf("expected archive_url when created with 3 urls")
+	}
+	testManager.WaitAll(context.Background())
+
+	body = `{"urls":["https://e.org/a.exe"]}`
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid extension, got %d", w.Code)
+	}
+}
+
+func TestRemoveAndReplaceFileEndpoints(t *testing.T) {
+	testRouter := setupRouter(t)
+
+	body := `{"urls":["https://e.org/a.pdf","https://e.org/b.jpeg"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+	var resp map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	id := resp["task_id"].(string)
+
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/tasks/"+id+"/files/0", strings.NewReader(`{"url":"https://e.org/fixed.pdf"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on replace, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/tasks/"+id+"/files/1", nil)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on delete, got %d", w.Code)
+	}
+	var taskResp map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &taskResp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	files := taskResp["files"].([]any)
+	if len(files) != 1 || files[0].(map[string]any)["url"] != "https://e.org/fixed.pdf" {
+		t.Fatalf("unexpected files: %v", files)
+	}
+	if taskResp["remaining_slots"] != float64(2) {
+		t.Fatalf("expected 2 remaining slots, got %v", taskResp["remaining_slots"])
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/tasks/"+id+"/files/7", nil)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for missing index, got %d", w.Code)
+	}
+}
+
+func TestFileContentAndArchiveEntries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testRouter := gin.Default()
+	testManager := task.NewManagerWithOptions(task.Options{DataDir: t.TempDir(), AllowedExtensions: []string{".pdf", ".jpeg"}, MaxConcurrentTasks: 3})
+	testManager.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		f, err := os.Create(dest)
+		if err != nil {
+			return nil, err
+		}
+		zw := zip.NewWriter(f)
+		// The first server answered with an HTML page under its own name.
+		names := []string{"a.html", "b.jpeg", "c.pdf"}
+		for _, name := range names[:2] {
+			entry, _ := zw.Create(name)
+			_, _ = entry.Write([]byte("content of " + name))
+		}
+		_ = zw.Close()
+		_ = f.Close()
+		results := make([]archive.Result, len(urls))
+		for i := range results {
+			results[i].Filename = names[i]
+		}
+		results[2].Err = "http 404"
+		return results, nil
+	})
+	apiHandler := NewAPI(testManager)
+	apiHandler.RegisterRoutes(testRouter)
+
+	body := `{"urls":["https://e.org/a.pdf","https://e.org/b.jpeg","https://e.org/c.pdf"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	var resp map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	id := resp["task_id"].(string)
+	testManager.WaitAll(context.Background())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+id+"/files/1/content", nil)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Fatalf("expected image/jpeg, got %q", ct)
+	}
+	if w.Body.String() != "content of b.jpeg" {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" || !strings.HasPrefix(w.Header().Get("Content-Disposition"), "inline") {
+		t.Fatalf("expected an inline nosniff preview, got %v", w.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+id+"/files/0/content", nil)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != "application/octet-stream" {
+		t.Fatalf("expected HTML served as octet-stream, got %d %q", w.Code, ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("expected a nosniff attachment, got %v", w.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+id+"/files/2/content", nil)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for failed file, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+id+"/archive/entries", nil)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var entriesResp struct {
+		Entries []struct {
+			Name  string `json:"name"`
+			Size  uint64 `json:"size"`
+			CRC32 string `json:"crc32"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &entriesResp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(entriesResp.Entries) != 2 || entriesResp.Entries[0].Name != "a.html" || len(entriesResp.Entries[0].CRC32) != 8 {
+		t.Fatalf("unexpected entries: %+v", entriesResp.Entries)
+	}
+}
+
+func TestUploadFiles(t *testing.T) {
+	testRouter := setupRouter(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", nil)
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	var resp map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	id := resp["task_id"].(string)
+
+	upload := func(name, content string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		part, _ := mw.CreateFormFile("files", name)
+		_, _ = part.Write([]byte(content))
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks/"+id+"/uploads", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	w = upload("scan.pdf", "%PDF-1.7 local scan")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var taskResp map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &taskResp)
+	files := taskResp["files"].([]any)
+	if len(files) != 1 || files[0].(map[string]any)["source"] != "upload" {
+		t.Fatalf("unexpected files after upload: %v", files)
+	}
+
+	w = upload("fake.pdf", "GIF89a not a pdf")
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 for mismatched content, got %d", w.Code)
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	dataDir := t.TempDir()
+	tm := task.NewManagerWithOptions(task.Options{DataDir: dataDir, AllowedExtensions: []string{".pdf"}, MaxConcurrentTasks: 1})
+	NewHealth(tm, HealthOptions{DataDir: dataDir, MinFreeDiskBytes: 1}).RegisterRoutes(router)
+
+	get := func(path string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode %s: %v", path, err)
+		}
+		return w.Code, body
+	}
+	checkStatus := func(body map[string]any, name string) string {
+		checks, _ := body["checks"].(map[string]any)
+		entry, _ := checks[name].(map[string]any)
+		status, _ := entry["status"].(string)
+		return status
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Fatalf("healthz: expected 200, got %d", code)
+	}
+	if code, body := get("/livez"); code != http.StatusOK || checkStatus(body, "task_manager") != "ok" {
+		t.Fatalf("livez: expected 200 with task_manager ok, got %d %v", code, body)
+	}
+
+	code, body := get("/readyz")
+	if code != http.StatusServiceUnavailable || checkStatus(body, "store") != "fail" {
+		t.Fatalf("readyz before load: expected 503 with store failing, got %d %v", code, body)
+	}
+
+	if err := tm.LoadFromDisk(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	code, body = get("/readyz")
+	if code != http.StatusOK {
+		t.Fatalf("readyz after load: expected 200, got %d %v", code, body)
+	}
+	for _, name := range []string{"data_dir", "disk_space", "store", "draining"} {
+		if checkStatus(body, name) != "ok" {
+			t.Fatalf("expected check %s ok, got %v", name, body)
+		}
+	}
+
+	tm.Drain("maintenance")
+	code, body = get("/readyz")
+	if code != http.StatusServiceUnavailable || checkStatus(body, "draining") != "fail" {
+		t.Fatalf("readyz while draining: expected 503, got %d %v", code, body)
+	}
+}
+
+func TestAdminDrainAndAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	tm := task.NewManagerWithOptions(task.Options{DataDir: t.TempDir(), AllowedExtensions: []string{".pdf"}, MaxConcurrentTasks: 1})
+	NewAPI(tm).RegisterRoutes(router)
+	NewAdmin(tm, "s3cret").RegisterRoutes(router)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/api/v1/admin/drain", "", ""); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected 401 without token, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/admin/drain", "wrong", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with wrong token, got %d", w.Code)
+	}
+
+	w := do(http.MethodPost, "/api/v1/admin/drain", "s3cret", `{"reason":"upgrade"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("drain: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodPost, "/api/v1/tasks", "", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("create while draining: expected 503, got %d", w.Code)
+	}
+	var p map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &p)
+	if p["code"] != "draining" || p["reason"] != "upgrade" {
+		t.Fatalf("expected draining problem with reason, got %v", p)
+	}
+
+	if w := do(http.MethodPut, "/api/v1/admin/concurrency", "s3cret", `{"max_concurrent_tasks":0}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for zero concurrency, got %d", w.Code)
+	}
+	w = do(http.MethodPut, "/api/v1/admin/concurrency", "s3cret", `{"max_concurrent_tasks":4}`)
+	var status map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &status)
+	if w.Code != http.StatusOK || status["max_concurrent_tasks"] != float64(4) || status["draining"] != true {
+		t.Fatalf("unexpected concurrency response %d %v", w.Code, status)
+	}
+
+	if w := do(http.MethodDelete, "/api/v1/admin/drain", "s3cret", ""); w.Code != http.StatusOK {
+		t.Fatalf("undrain: expected 200, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/tasks", "", ""); w.Code != http.StatusCreated {
+		t.Fatalf("create after drain: expected 201, got %d", w.Code)
+	}
+
+	w = do(http.MethodGet, "/api/v1/admin/quarantine", "s3cret", "")
+	var quarantine map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &quarantine)
+	if w.Code != http.StatusOK || quarantine["last_load"] == nil {
+		t.Fatalf("quarantine: expected 200 with last_load, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testRouter := gin.New()
+	testRouter.Use(RequestID())
+	testManager := task.NewManagerWithOptions(task.Options{DataDir: t.TempDir(), AllowedExtensions: []string{".pdf"}, MaxConcurrentTasks: 1})
+	NewAPI(testManager).RegisterRoutes(testRouter)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", nil)
+	req.Header.Set(RequestIDHeader, "client-req.42")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	if got := w.Header().Get(RequestIDHeader); got != "client-req.42" {
+		t.Fatalf("expected request id to be echoed, got %q", got)
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	created, ok := testManager.GetTask(resp["task_id"].(string))
+	if !ok || created.RequestID != "client-req.42" {
+		t.Fatalf("expected task to keep the request id, got %+v", created)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+created.ID, nil)
+	req.Header.Set(RequestIDHeader, "bad id with spaces")
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	generated := w.Header().Get(RequestIDHeader)
+	if generated == "" || generated == "bad id with spaces" {
+		t.Fatalf("expected a generated request id, got %q", generated)
+	}
+	if !strings.Contains(w.Body.String(), `"request_id":"client-req.42"`) {
+		t.Fatalf("expected originating request id in task response, got %s", w.Body.String())
+	}
+}
+
+func TestAuditTrail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	auditLog, err := audit.Open(audit.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("open audit: %v", err)
+	}
+	defer func() { _ = auditLog.Close() }()
+	router.Use(Audit(auditLog))
+	tm := task.NewManagerWithOptions(task.Options{DataDir: t.TempDir(), AllowedExtensions: []string{".pdf"}, MaxConcurrentTasks: 1})
+	NewAPI(tm).RegisterRoutes(router)
+	admin := NewAdmin(tm, "s3cret")
+	admin.UseAudit(auditLog)
+	admin.RegisterRoutes(router)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/v1/tasks", "", "")
+	var created map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	taskID, _ := created["task_id"].(string)
+	do(http.MethodPost, "/api/v1/tasks/"+taskID+"/files", "", `{"urls":["http://example.com/a.exe"]}`)
+	do(http.MethodGet, "/api/v1/tasks/"+taskID, "", "")
+	do(http.MethodGet, "/api/v1/tasks/"+taskID+"/archive", "", "")
+	do(http.MethodGet, "/api/v1/tasks/"+taskID+"/files/0/content", "", "")
+	do(http.MethodPost, "/api/v1/admin/pause", "s3cret", "")
+
+	if w := do(http.MethodGet, "/api/v1/admin/audit?since=yesterday", "s3cret", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad since, got %d", w.Code)
+	}
+	w = do(http.MethodGet, "/api/v1/admin/audit?task_id="+taskID, "s3cret", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("audit query: expected 200, got %d", w.Code)
+	}
+	var resp struct {
+		Entries []audit.Entry `json:"entries"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Entries) != 4 {
+		t.Fatalf("expected create, add_files and two download entries, got %+v", resp.Entries)
+	}
+	want := []struct{ action, outcome string }{
+		{"task.create", audit.OutcomeSuccess},
+		{"task.add_files", audit.OutcomeFailure},
+		{"archive.download", audit.OutcomeFailure},
+		{"archive.download_file", audit.OutcomeFailure},
+	}
+	for i, e := range resp.Entries {
+		if e.Action != want[i].action || e.Outcome != want[i].outcome || !strings.HasPrefix(e.Actor, "ip:") {
+			t.Fatalf("entry %d: expected %s/%s, got %+v", i, want[i].action, want[i].outcome, e)
+		}
+	}
+
+	all, _, err := auditLog.Query(audit.Filter{})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	last := all[len(all)-1]
+	if last.Action != "admin.pause" || last.Actor != "admin" || last.Channel != "admin" {
+		t.Fatalf("expected admin pause entry, got %+v", last)
+	}
+}
+
+// memArchives is an in-memory ArchiveStorage standing in for a remote bucket.
+type memArchives struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+type readSeekNopCloser struct{ *bytes.Reader }
+
+func (readSeekNopCloser) Close() error { return nil }
+
+func (m *memArchives) Put(_ context.Context, key, localPath string) error {
+	body, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = body
+	return nil
+}
+
+func (m *memArchives) Open(_ context.Context, key string) (*storage.Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	body, ok := m.objects[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &storage.Object{ReadSeekCloser: readSeekNopCloser{bytes.NewReader(body)}, Size: int64(len(body))}, nil
+}
+
+func (m *memArchives) PresignGet(_ context.Context, key, filename string, ttl time.Duration) (string, error) {
+	return "https://bucket.example/" + key + "?filename=" + filename + "&ttl=" + ttl.String(), nil
+}
+
+func (m *memArchives) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memArchives) Driver() string { return "mem" }
+
+func TestDownloadArchiveFromRemoteStorage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testRouter := gin.New()
+	archives := &memArchives{objects: make(map[string][]byte)}
+	testManager := task.NewManagerWithOptions(task.Options{DataDir: t.TempDir(), AllowedExtensions: []string{".pdf"}, MaxConcurrentTasks: 1, Archives: archives})
+	testManager.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		f, err := os.Create(dest)
+		if err != nil {
+			return nil, err
+		}
+		zw := zip.NewWriter(f)
+		w, _ := zw.Create("a.pdf")
+		_, _ = w.Write([]byte("%PDF"))
+		_ = zw.Close()
+		_ = f.Close()
+		results := make([]archive.Result, len(urls))
+		for i := range results {
+			results[i].Filename = "a.pdf"
+		}
+		return results, nil
+	})
+	apiHandler := NewAPI(testManager)
+	apiHandler.RegisterRoutes(testRouter)
+
+	body := `{"urls":["https://e.org/a.pdf","https://e.org/b.pdf","https://e.org/c.pdf"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	var created map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	id, _ := created["task_id"].(string)
+	if w.Code != http.StatusCreated || id == "" {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	var readyTask *task.Task
+	for time.Now().Before(deadline) {
+		if tsk, ok := testManager.GetTask(id); ok && tsk.Status == task.StatusReady {
+			readyTask = tsk
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if readyTask == nil {
+		t.Fatalf("task did not become ready")
+	}
+	if len(archives.objects[id]) == 0 {
+		t.Fatalf("archive was not uploaded")
+	}
+
+	// Another replica has no local copy: downloads and entry listings must
+	// come from the storage.
+	if err := os.Remove(readyTask.ArchivePath); err != nil {
+		t.Fatalf("remove local archive: %v", err)
+	}
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+id+"/archive", nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), archives.objects[id]) {
+		t.Fatalf("proxy download: %d, %d bytes", w.Code, w.Body.Len())
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "archive-"+id+".zip") {
+		t.Fatalf("unexpected Content-Disposition %q", cd)
+	}
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+id+"/archive/entries", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"a.pdf"`) {
+		t.Fatalf("entries from fetched archive: %d %s", w.Code, w.Body.String())
+	}
+
+	apiHandler.UseArchiveRedirect(time.Minute)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+id+"/archive", nil))
+	if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), "https://bucket.example/"+id) {
+		t.Fatalf("expected redirect to presigned url, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w.Header().Get("ETag") != `"`+readyTask.ArchiveSHA256+`"` || !strings.HasPrefix(w.Header().Get("Repr-Digest"), "sha-256=:") || w.Header().Get("Digest") == "" {
+		t.Fatalf("expected checksum headers on the redirect, got %v", w.Header())
+	}
+
+	_ = archives.Delete(context.Background(), id)
+	apiHandler.UseArchiveRedirect(0)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+id+"/archive", nil))
+	if w.Code != http.StatusGone {
+		t.Fatalf("expected 410 for a missing object, got %d", w.Code)
+	}
 }
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"workmate/internal/back/health"
+	"workmate/internal/back/task"
+)
+
+type HealthOptions struct {
+	DataDir          string
+	MinFreeDiskBytes uint64
+}
+
+type Health struct {
+	liveness  *health.Checker
+	readiness *health.Checker
+}
+
+func NewHealth(taskManager *task.Manager, opts HealthOptions) *Health {
+	liveness := health.NewChecker()
+	liveness.Add("task_manager", taskManager.Ping)
+
+	readiness := health.NewChecker()
+	readiness.Add("data_dir", health.DirWritable(opts.DataDir))
+	readiness.Add("disk_space", health.FreeDiskSpace(opts.DataDir, opts.MinFreeDiskBytes))
+	readiness.Add("store", func(context.Context) error { return taskManager.StoreReady() })
+	readiness.Add("draining", func(context.Context) error {
+		if draining, reason := taskManager.DrainState(); draining {
+			if reason == "" {
+				return errors.New("server is draining")
+			}
+			return errors.New("server is draining: " + reason)
+		}
+		return nil
+	})
+
+	return &Health{liveness: liveness, readiness: readiness}
+}
+
+func (h *Health) RegisterRoutes(router *gin.Engine) {
+	router.GET("/healthz", h.Healthz)
+	router.GET("/livez", h.Livez)
+	router.GET("/readyz", h.Readyz)
+}
+
+func (h *Health) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+func (h *Health) Livez(c *gin.Context) {
+	writeReport(c, h.liveness.Run(c.Request.Context()))
+}
+
+func (h *Health) Readyz(c *gin.Context) {
+	writeReport(c, h.readiness.Run(c.Request.Context()))
+}
+
+func writeReport(c *gin.Context, report health.Report) {
+	c.Header("Cache-Control", "no-store")
+	if !report.OK() {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
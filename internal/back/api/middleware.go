@@ -1,17 +1,74 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"workmate/internal/back/logging"
+	"workmate/internal/back/metrics"
+	"workmate/internal/back/tracing"
 )
 
 const (
+	RequestIDHeader = "X-Request-ID"
+
+	maxRequestIDLength   = 128
 	statusWarnThreshold  = 400
 	statusErrorThreshold = 500
+	unmatchedRoute       = "unmatched"
 )
 
+// RequestID accepts a well-formed X-Request-ID from the client or generates
+// one, echoes it back and stores it in the request context for logging.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		isAlnum := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if !isAlnum && r != '-' && r != '_' && r != '.' && r != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+func reqLog(c *gin.Context) *zerolog.Logger {
+	return log.Ctx(c.Request.Context())
+}
+
 func ZerologLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
@@ -27,12 +84,12 @@ func ZerologLogger() gin.HandlerFunc {
 		status := c.Writer.Status()
 		size := c.Writer.Size()
 
-		evt := log.Info()
+		evt := reqLog(c).Info()
 		switch {
 		case status >= statusErrorThreshold:
-			evt = log.Error()
+			evt = reqLog(c).Error()
 		case status >= statusWarnThreshold:
-			evt = log.Warn()
+			evt = reqLog(c).Warn()
 		}
 
 		if raw != "" {
@@ -50,3 +107,51 @@ func ZerologLogger() gin.HandlerFunc {
 			Msg("http request completed")
 	}
 }
+
+func PrometheusMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		metrics.ObserveHTTPRequest(route, c.Request.Method, c.Writer.Status(), time.Since(start))
+	}
+}
+
+func OtelTracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.ClientAddress(c.ClientIP()),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+		if id := logging.RequestIDFromContext(ctx); id != "" {
+			span.SetAttributes(attribute.String("request.id", id))
+		}
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= statusErrorThreshold {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"workmate/internal/back/problem"
+)
+
+func writeProblem(c *gin.Context, err error) {
+	p := problem.FromError(err)
+	p.Instance = c.Request.URL.Path
+	c.Header("Content-Type", problem.ContentType)
+	c.JSON(p.Status, p)
+}
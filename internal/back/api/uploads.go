@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"workmate/internal/back/problem"
+	"workmate/internal/back/task"
+)
+
+const uploadFormField = "files"
+
+func (a *API) UploadFiles(c *gin.Context) {
+	id := c.Param("id")
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, task.MaxUploadRequestBytes)
+	form, err := c.MultipartForm()
+	if err != nil {
+		reqLog(c).Warn().Str("task_id", id).Err(err).Msg("invalid multipart upload")
+		writeProblem(c, problem.ErrInvalidRequest)
+		return
+	}
+	defer func() { _ = form.RemoveAll() }()
+
+	currentTask, err := a.taskManager.AddUploads(c.Request.Context(), id, task.MultipartUploads(form.File[uploadFormField]))
+	if err != nil {
+		reqLog(c).Warn().Str("task_id", id).Err(err).Msg("failed to add uploads")
+		writeProblem(c, err)
+		return
+	}
+	reqLog(c).Info().Str("task_id", id).Int("uploads", len(form.File[uploadFormField])).Int("files_total", len(currentTask.Files)).Msg("files uploaded to task")
+	c.JSON(http.StatusOK, a.toTaskResponse(currentTask, c))
+}
@@ -7,15 +7,25 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"workmate/internal/back/logging"
+	"workmate/internal/back/metrics"
+	"workmate/internal/back/tracing"
 )
 
+var log = logging.Package("archive")
+
 type Result struct {
 	Filename string
 	Err      string
@@ -30,8 +40,12 @@ type ctxKey int
 
 const (
 	ctxKeyHTTPTimeout ctxKey = iota
+	ctxKeyCompression
+	ctxKeyUploadDir
 )
 
+const UploadScheme = "upload://"
+
 func WithHTTPTimeout(parent context.Context, timeout time.Duration) context.Context {
 	return context.WithValue(parent, ctxKeyHTTPTimeout, timeout)
 }
@@ -44,11 +58,40 @@ func httpTimeoutFromContext(ctx context.Context) time.Duration {
 	return defaultHTTPTimeout
 }
 
-func BuildArchive(ctx context.Context, destZipPath string, urls []string) ([]Result, error) {
+func WithCompression(parent context.Context, method uint16) context.Context {
+	return context.WithValue(parent, ctxKeyCompression, method)
+}
+
+func CompressionFromContext(ctx context.Context) uint16 {
+	if method, ok := ctx.Value(ctxKeyCompression).(uint16); ok {
+		return method
+	}
+	return zip.Deflate
+}
+
+func WithUploadDir(parent context.Context, dir string) context.Context {
+	return context.WithValue(parent, ctxKeyUploadDir, dir)
+}
+
+func uploadDirFromContext(ctx context.Context) string {
+	dir, _ := ctx.Value(ctxKeyUploadDir).(string)
+	return dir
+}
+
+func BuildArchive(ctx context.Context, destZipPath string, urls []string) (results []Result, err error) {
 	if len(urls) == 0 {
 		return nil, errors.New("no urls provided")
 	}
 
+	ctx, span := tracing.Tracer().Start(ctx, "archive.build", trace.WithAttributes(attribute.Int("archive.files", len(urls))))
+	start := time.Now()
+	defer func() {
+		size := fileSize(destZipPath)
+		metrics.ObserveArchiveBuild(time.Since(start), size, err)
+		span.SetAttributes(attribute.Int64("archive.size_bytes", size))
+		endSpan(span, err)
+	}()
+
 	zipFile, zipWriter, err := prepareZip(destZipPath)
 	if err != nil {
 		return nil, err
@@ -58,32 +101,19 @@ func BuildArchive(ctx context.Context, destZipPath string, urls []string) ([]Res
 
 	client := &http.Client{Timeout: httpTimeoutFromContext(ctx)}
 
-	results := make([]Result, len(urls))
+	results = make([]Result, len(urls))
 	usedNames := make(map[string]int, len(urls))
 	for i, rawURL := range urls {
-		res := processURL(ctx, client, zipWriter, rawURL, i)
-
-		if res.Filename != "" {
-			base := res.Filename
-			if count, ok := usedNames[base]; ok {
-				count++
-				usedNames[base] = count
-				ext := filepath.Ext(base)
-				name := strings.TrimSuffix(base, ext)
-				res.Filename = fmt.Sprintf("%s(%d)%s", name, count, ext)
-			} else {
-				usedNames[base] = 1
-			}
-		}
-		results[i] = res
+		filename := uniqueFilename(usedNames, deriveFilename(rawURL, i))
+		results[i] = processURL(ctx, client, zipWriter, rawURL, filename)
 	}
 
 	if err := zipWriter.Close(); err != nil {
-		log.Error().Err(err).Msg("closing zip writer failed")
+		log.Ctx(ctx).Error().Err(err).Msg("closing zip writer failed")
 		return results, fmt.Errorf("close zip writer: %w", err)
 	}
 	if err := zipFile.Close(); err != nil {
-		log.Error().Err(err).Msg("closing zip file failed")
+		log.Ctx(ctx).Error().Err(err).Msg("closing zip file failed")
 		return results, fmt.Errorf("close zip file: %w", err)
 	}
 	return results, nil
@@ -98,44 +128,86 @@ func prepareZip(destZipPath string) (io.WriteCloser, *zip.Writer, error) {
 	return zipFile, zipWriter, nil
 }
 
-func processURL(ctx context.Context, client *http.Client, zipWriter *zip.Writer, rawURL string, index int) Result {
+func processURL(ctx context.Context, client *http.Client, zipWriter *zip.Writer, rawURL, filename string) Result {
 	url := strings.TrimSpace(rawURL)
-	filename := deriveFilename(url, index)
 	result := Result{Filename: filename}
 
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if strings.HasPrefix(url, UploadScheme) {
+		return processUpload(ctx, zipWriter, strings.TrimPrefix(url, UploadScheme), result)
+	}
+
+	var (
+		statusCode  int
+		written     int64
+		downloadErr error
+	)
+	host := hostOf(url)
+	ctx, span := tracing.Tracer().Start(ctx, "archive.download", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPRequestMethodGet,
+		semconv.URLFull(url),
+		semconv.ServerAddress(host),
+		attribute.String("archive.entry", filename),
+	))
+	start := time.Now()
+	defer func() {
+		metrics.ObserveDownload(host, written, time.Since(start), downloadErr, statusCode)
+		if statusCode != 0 {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(statusCode))
+		}
+		span.SetAttributes(attribute.Int64("archive.bytes_written", written))
+		if downloadErr == nil && result.Err != "" {
+			span.SetStatus(codes.Error, result.Err)
+		}
+		endSpan(span, downloadErr)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		downloadErr = err
+		result.Err = err.Error()
+		log.Ctx(ctx).Warn().Str("url", url).Err(err).Msg("invalid request url")
+		return result
+	}
 
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
 	req.Header.Set("Referer", "https://www.google.com/")
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
 	httpResponse, err := client.Do(req)
 	if err != nil {
+		downloadErr = err
 		result.Err = err.Error()
-		log.Warn().Str("url", url).Err(err).Msg("http request failed")
+		log.Ctx(ctx).Warn().Str("url", url).Err(err).Msg("http request failed")
 		return result
 	}
+	statusCode = httpResponse.StatusCode
 
 	if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
 		if httpResponse.Body != nil {
 			_ = httpResponse.Body.Close()
 		}
 		result.Err = fmt.Sprintf("http %d", httpResponse.StatusCode)
-		log.Warn().Str("url", url).Int("status", httpResponse.StatusCode).Msg("unexpected status code")
+		log.Ctx(ctx).Warn().Str("url", url).Int("status", httpResponse.StatusCode).Msg("unexpected status code")
 		return result
 	}
 
-	zipEntryWriter, err := zipWriter.Create(filename)
+	zipEntryWriter, err := zipWriter.CreateHeader(&zip.FileHeader{Name: filename, Method: CompressionFromContext(ctx)})
 	if err != nil {
+		downloadErr = err
 		result.Err = err.Error()
-		log.Warn().Str("url", url).Err(err).Msg("zip entry create failed")
+		log.Ctx(ctx).Warn().Str("url", url).Err(err).Msg("zip entry create failed")
 		return result
 	}
 
-	if _, err := io.Copy(zipEntryWriter, httpResponse.Body); err != nil {
+	written, err = io.Copy(zipEntryWriter, httpResponse.Body)
+	if err != nil {
+		downloadErr = err
 		if httpResponse.Body != nil {
 			_ = httpResponse.Body.Close()
 		}
 		result.Err = err.Error()
-		log.Warn().Str("url", url).Err(err).Msg("copy into zip failed")
+		log.Ctx(ctx).Warn().Str("url", url).Err(err).Msg("copy into zip failed")
 		return result
 	}
 	if httpResponse.Body != nil {
@@ -144,6 +216,79 @@ func processURL(ctx context.Context, client *http.Client, zipWriter *zip.Writer,
 	return result
 }
 
+func processUpload(ctx context.Context, zipWriter *zip.Writer, storedName string, result Result) Result {
+	_, span := tracing.Tracer().Start(ctx, "archive.add_upload", trace.WithAttributes(attribute.String("archive.entry", result.Filename)))
+	defer func() {
+		if result.Err != "" {
+			span.SetStatus(codes.Error, result.Err)
+		}
+		span.End()
+	}()
+
+	uploadDir := uploadDirFromContext(ctx)
+	if uploadDir == "" {
+		result.Err = "uploads are not available"
+		return result
+	}
+	uploadFile, err := os.Open(filepath.Join(uploadDir, filepath.Base(storedName)))
+	if err != nil {
+		result.Err = err.Error()
+		log.Ctx(ctx).Warn().Str("upload", storedName).Err(err).Msg("open upload failed")
+		return result
+	}
+	defer func() { _ = uploadFile.Close() }()
+
+	zipEntryWriter, err := zipWriter.CreateHeader(&zip.FileHeader{Name: result.Filename, Method: CompressionFromContext(ctx)})
+	if err != nil {
+		result.Err = err.Error()
+		log.Ctx(ctx).Warn().Str("upload", storedName).Err(err).Msg("zip entry create failed")
+		return result
+	}
+	if _, err := io.Copy(zipEntryWriter, uploadFile); err != nil {
+		result.Err = err.Error()
+		log.Ctx(ctx).Warn().Str("upload", storedName).Err(err).Msg("copy upload into zip failed")
+		return result
+	}
+	return result
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func hostOf(rawURL string) string {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return "unknown"
+	}
+	return parsed.Hostname()
+}
+
+func fileSize(filePath string) int64 {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
+
+func uniqueFilename(usedNames map[string]int, base string) string {
+	count, ok := usedNames[base]
+	if !ok {
+		usedNames[base] = 1
+		return base
+	}
+	count++
+	usedNames[base] = count
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	return fmt.Sprintf("%s(%d)%s", name, count, ext)
+}
+
 func deriveFilename(rawURL string, index int) string {
 	trimmed := strings.TrimSpace(rawURL)
 	if trimmed == "" {
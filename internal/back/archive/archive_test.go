@@ -1,8 +1,10 @@
 package archive
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -78,3 +80,81 @@ func TestBuildArchive_NoURLs(t *testing.T) {
 		t.Fatalf("expected error for no urls, got %v", err)
 	}
 }
+
+func TestListAndOpenEntries(t *testing.T) {
+	srv := newStubServer()
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "out.zip")
+	ctx := WithHTTPTimeout(context.Background(), 2*time.Second)
+	results, err := BuildArchive(ctx, dest, []string{srv.URL + "/ok.pdf", srv.URL + "/ok.pdf"})
+	if err != nil {
+		t.Fatalf("BuildArchive error: %v", err)
+	}
+
+	entries, err := ListEntries(dest)
+	if err != nil {
+		t.Fatalf("ListEntries: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	for i, e := range entries {
+		if e.Name != results[i].Filename {
+			t.Fatalf("entry %d name %q does not match result filename %q", i, e.Name, results[i].Filename)
+		}
+		if e.Size != uint64(len("hello")) || e.CRC32 == 0 || e.Method != "deflate" {
+			t.Fatalf("unexpected entry metadata: %+v", e)
+		}
+	}
+
+	rc, entry, err := OpenEntry(dest, results[1].Filename)
+	if err != nil {
+		t.Fatalf("OpenEntry: %v", err)
+	}
+	body, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(body) != "hello" || entry.Name != results[1].Filename {
+		t.Fatalf("unexpected entry content %q (%+v)", body, entry)
+	}
+
+	if _, _, err := OpenEntry(dest, "missing.pdf"); err != ErrEntryNotFound {
+		t.Fatalf("expected ErrEntryNotFound, got %v", err)
+	}
+}
+
+func TestVerifyDetectsCorruption(t *testing.T) {
+	srv := newStubServer()
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "out.zip")
+	ctx := WithCompression(WithHTTPTimeout(context.Background(), 2*time.Second), zip.Store)
+	if _, err := BuildArchive(ctx, dest, []string{srv.URL + "/ok.pdf"}); err != nil {
+		t.Fatalf("BuildArchive error: %v", err)
+	}
+	if err := Verify(dest); err != nil {
+		t.Fatalf("expected a fresh archive to verify, got %v", err)
+	}
+
+	raw, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	corrupt := bytes.Replace(raw, []byte("hello"), []byte("jello"), 1)
+	if bytes.Equal(corrupt, raw) {
+		t.Fatalf("stored entry payload not found in archive")
+	}
+	if err := os.WriteFile(dest, corrupt, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := Verify(dest); !errors.Is(err, ErrCorruptArchive) {
+		t.Fatalf("expected ErrCorruptArchive for a bad crc, got %v", err)
+	}
+
+	if err := os.WriteFile(dest, raw[:len(raw)/2], 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := Verify(dest); !errors.Is(err, ErrCorruptArchive) {
+		t.Fatalf("expected ErrCorruptArchive for a truncated file, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package archive
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	ErrEntryNotFound  = errors.New("archive entry not found")
+	ErrCorruptArchive = errors.New("archive is corrupt")
+)
+
+type Entry struct {
+	Name             string
+	Size             uint64
+	CompressedSize   uint64
+	CRC32            uint32
+	Method           string
+	CompressionRatio float64
+	Modified         time.Time
+}
+
+func ListEntries(zipPath string) ([]Entry, error) {
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("open zip: %w", err)
+	}
+	defer func() { _ = zipReader.Close() }()
+
+	entries := make([]Entry, 0, len(zipReader.File))
+	for _, f := range zipReader.File {
+		entries = append(entries, entryFromHeader(&f.FileHeader))
+	}
+	return entries, nil
+}
+
+// Verify decompresses every entry of the zip at zipPath, so a truncated file
+// or an entry whose CRC or size does not match its header is reported as
+// ErrCorruptArchive.
+func Verify(zipPath string) error {
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptArchive, err)
+	}
+	defer func() { _ = zipReader.Close() }()
+
+	for _, f := range zipReader.File {
+		if err := verifyEntry(f); err != nil {
+			return fmt.Errorf("%w: entry %s: %v", ErrCorruptArchive, f.Name, err)
+		}
+	}
+	return nil
+}
+
+func verifyEntry(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(io.Discard, rc)
+	if closeErr := rc.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if uint64(n) != f.UncompressedSize64 {
+		return fmt.Errorf("read %d bytes, header says %d", n, f.UncompressedSize64)
+	}
+	return nil
+}
+
+func OpenEntry(zipPath, name string) (io.ReadCloser, Entry, error) {
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, Entry{}, fmt.Errorf("open zip: %w", err)
+	}
+	for _, f := range zipReader.File {
+		if f.Name != name {
+			continue
+		}
+		entryReader, err := f.Open()
+		if err != nil {
+			_ = zipReader.Close()
+			return nil, Entry{}, fmt.Errorf("open entry: %w", err)
+		}
+		return &entryReadCloser{ReadCloser: entryReader, archive: zipReader}, entryFromHeader(&f.FileHeader), nil
+	}
+	_ = zipReader.Close()
+	return nil, Entry{}, ErrEntryNotFound
+}
+
+type entryReadCloser struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (r *entryReadCloser) Close() error {
+	entryErr := r.ReadCloser.Close()
+	if err := r.archive.Close(); err != nil {
+		return err
+	}
+	return entryErr
+}
+
+func entryFromHeader(h *zip.FileHeader) Entry {
+	e := Entry{
+		Name:           h.Name,
+		Size:           h.UncompressedSize64,
+		CompressedSize: h.CompressedSize64,
+		CRC32:          h.CRC32,
+		Method:         methodName(h.Method),
+		Modified:       h.Modified,
+	}
+	if h.CompressedSize64 > 0 {
+		e.CompressionRatio = float64(h.UncompressedSize64) / float64(h.CompressedSize64)
+	}
+	return e
+}
+
+func methodName(method uint16) string {
+	switch method {
+	case zip.Store:
+		return "store"
+	case zip.Deflate:
+		return "deflate"
+	default:
+		return fmt.Sprintf("method-%d", method)
+	}
+}
@@ -0,0 +1,280 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"workmate/internal/back/logging"
+)
+
+const (
+	activeFile      = "audit.jsonl"
+	rotatedPrefix   = "audit-"
+	rotatedSuffix   = ".jsonl"
+	rotatedLayout   = "20060102T150405.000000000Z"
+	defaultMaxBytes = 50 << 20
+
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Gin context keys that handlers and middleware use to enrich the entry
+// recorded for the current request.
+const (
+	TaskIDKey = "audit.task_id"
+	ActorKey  = "audit.actor"
+)
+
+var log = logging.Package("audit")
+
+type Entry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Actor     string    `json:"actor"`
+	Channel   string    `json:"channel"`
+	Action    string    `json:"action"`
+	TaskID    string    `json:"task_id,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Status    int       `json:"status,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+type Filter struct {
+	TaskID string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+func (f Filter) match(e Entry) bool {
+	if f.TaskID != "" && e.TaskID != f.TaskID {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+type Options struct {
+	Dir          string
+	MaxSizeBytes int64
+}
+
+// Log is an append-only JSON Lines journal. The active file is renamed to
+// audit-<timestamp>.jsonl once it exceeds MaxSizeBytes; rotated files are
+// never rewritten or removed.
+type Log struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	file     *os.File
+	size     int64
+	now      func() time.Time
+}
+
+func Open(opts Options) (*Log, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("audit dir is required")
+	}
+	if opts.MaxSizeBytes <= 0 {
+		opts.MaxSizeBytes = defaultMaxBytes
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create audit dir: %w", err)
+	}
+	l := &Log{dir: opts.Dir, maxBytes: opts.MaxSizeBytes, now: time.Now}
+	if err := l.openActive(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) openActive() error {
+	f, err := os.OpenFile(filepath.Join(l.dir, activeFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("stat audit log: %w", err)
+	}
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// Record appends e, filling in the time and outcome when they are unset.
+func (l *Log) Record(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = l.now()
+	}
+	e.Time = e.Time.UTC()
+	if e.Outcome == "" {
+		e.Outcome = OutcomeSuccess
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return errors.New("audit log is closed")
+	}
+	if l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	return nil
+}
+
+func (l *Log) rotateLocked() error {
+	if err := l.file.Close(); err != nil {
+		log.Warn().Err(err).Msg("close audit log before rotation failed")
+	}
+	l.file = nil
+	// Never overwrite an earlier rotation, even if the clock did not move.
+	rotatedAt := l.now().UTC()
+	rotated := filepath.Join(l.dir, rotatedPrefix+rotatedAt.Format(rotatedLayout)+rotatedSuffix)
+	for {
+		if _, err := os.Stat(rotated); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		rotatedAt = rotatedAt.Add(time.Nanosecond)
+		rotated = filepath.Join(l.dir, rotatedPrefix+rotatedAt.Format(rotatedLayout)+rotatedSuffix)
+	}
+	if err := os.Rename(filepath.Join(l.dir, activeFile), rotated); err != nil {
+		log.Error().Err(err).Msg("rotate audit log failed")
+	}
+	return l.openActive()
+}
+
+// Query scans rotated files oldest first and then the active file, returning
+// matching entries in chronological order. The second result reports whether
+// more entries matched than the limit allowed.
+func (l *Log) Query(f Filter) ([]Entry, bool, error) {
+	if f.Limit <= 0 {
+		f.Limit = DefaultLimit
+	}
+	f.Limit = min(f.Limit, MaxLimit)
+
+	l.mu.Lock()
+	files, err := l.filesLocked(f.Since)
+	l.mu.Unlock()
+	if err != nil {
+		return nil, false, err
+	}
+
+	entries := make([]Entry, 0)
+	for _, path := range files {
+		done, err := scanFile(path, func(e Entry) bool {
+			if !f.match(e) {
+				return true
+			}
+			if len(entries) == f.Limit {
+				return false
+			}
+			entries = append(entries, e)
+			return true
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		if done {
+			return entries, true, nil
+		}
+	}
+	return entries, false, nil
+}
+
+// filesLocked lists the journal files worth scanning. A rotated file only
+// holds entries written before its rotation time, so files rotated before
+// since are skipped.
+func (l *Log) filesLocked(since time.Time) ([]string, error) {
+	dirEntries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var rotated []string
+	for _, de := range dirEntries {
+		name := de.Name()
+		if de.IsDir() || !strings.HasPrefix(name, rotatedPrefix) || !strings.HasSuffix(name, rotatedSuffix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, rotatedPrefix), rotatedSuffix)
+		if rotatedAt, err := time.Parse(rotatedLayout, stamp); err == nil && !since.IsZero() && rotatedAt.Before(since) {
+			continue
+		}
+		rotated = append(rotated, filepath.Join(l.dir, name))
+	}
+	sort.Strings(rotated)
+	return append(rotated, filepath.Join(l.dir, activeFile)), nil
+}
+
+func scanFile(path string, visit func(Entry) bool) (stopped bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Warn().Str("file", filepath.Base(path)).Err(err).Msg("skipping malformed audit line")
+			continue
+		}
+		if !visit(e) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
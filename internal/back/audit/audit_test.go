@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordRotateAndQuery(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(Options{Dir: dir, MaxSizeBytes: 300})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := base
+	l.now = func() time.Time { return clock }
+	for i := 0; i < 6; i++ {
+		clock = base.Add(time.Duration(i) * time.Minute)
+		taskID := "aaaa0001"
+		if i%2 == 1 {
+			taskID = "bbbb0002"
+		}
+		if err := l.Record(Entry{Actor: "ip:127.0.0.1", Channel: "api", Action: "task.add_files", TaskID: taskID, Status: 200}); err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+	}
+
+	names, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	rotated := 0
+	for _, n := range names {
+		if strings.HasPrefix(n.Name(), rotatedPrefix) {
+			rotated++
+		}
+	}
+	if rotated == 0 {
+		t.Fatalf("expected rotated files, got %v", names)
+	}
+
+	all, truncated, err := l.Query(Filter{})
+	if err != nil || truncated || len(all) != 6 {
+		t.Fatalf("expected 6 entries, got %d (truncated=%v, err=%v)", len(all), truncated, err)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Time.Before(all[i-1].Time) {
+			t.Fatalf("entries out of order: %v", all)
+		}
+	}
+
+	byTask, _, _ := l.Query(Filter{TaskID: "bbbb0002"})
+	if len(byTask) != 3 {
+		t.Fatalf("expected 3 entries for task, got %d", len(byTask))
+	}
+
+	ranged, _, _ := l.Query(Filter{Since: base.Add(2 * time.Minute), Until: base.Add(4 * time.Minute)})
+	if len(ranged) != 2 || ranged[0].Outcome != OutcomeSuccess {
+		t.Fatalf("expected 2 entries in range, got %+v", ranged)
+	}
+
+	limited, truncated, _ := l.Query(Filter{Limit: 4})
+	if len(limited) != 4 || !truncated {
+		t.Fatalf("expected 4 truncated entries, got %d (truncated=%v)", len(limited), truncated)
+	}
+}
+
+func TestReopenAppends(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		l, err := Open(Options{Dir: dir})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		if err := l.Record(Entry{Actor: "system", Action: "task.create", TaskID: "cccc0003"}); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+		_ = l.Close()
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, activeFile))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if lines := strings.Count(string(raw), "\n"); lines != 2 {
+		t.Fatalf("expected 2 lines after reopen, got %d", lines)
+	}
+}
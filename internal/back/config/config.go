@@ -1,25 +1,164 @@
 package config
 
 import (
-	"errors"
 	"fmt"
-	"os"
+	"regexp"
 	"strings"
+	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/rs/zerolog"
 )
 
 const (
 	defaultPort               = 8080
 	defaultDataDir            = "storage/data"
 	defaultMaxConcurrentTasks = 3
+
+	defaultDownloadTimeout = 20 * time.Second
+	defaultLogLevel        = "info"
+	defaultLogFile         = "storage/logs/workmate.log"
+	defaultReloadInterval  = 2 * time.Second
+
+	defaultMinFreeDiskMB  = 100
+	defaultAuditMaxSizeMB = 50
+
+	defaultJournalCompactEvery    = 1000
+	defaultJournalCompactInterval = 5 * time.Minute
+	minJournalCompactInterval     = time.Second
+
+	defaultLeaseTTL = 30 * time.Second
+	minLeaseTTL     = time.Second
+
+	defaultPresignTTL = 15 * time.Minute
+	// maxPresignTTL is the longest expiry SigV4 presigned urls allow.
+	maxPresignTTL = 7 * 24 * time.Hour
+
+	maxConcurrentTasksLimit = 256
+	maxDownloadTimeout      = time.Hour
+	minReloadInterval       = 100 * time.Millisecond
+	minAdminTokenLength     = 16
+
+	defaultTracingExporter    = "otlp"
+	defaultTracingEndpoint    = "localhost:4318"
+	defaultTracingServiceName = "workmate"
 )
 
+var extensionPattern = regexp.MustCompile(`^\.[a-z0-9]+$`)
+
 type Config struct {
-	Port               int      `yaml:"port"`
-	DataDir            string   `yaml:"data_dir"`
-	AllowedExtensions  []string `yaml:"allowed_extensions"`
-	MaxConcurrentTasks int      `yaml:"max_concurrent_tasks"`
+	Port               int            `yaml:"port"`
+	DataDir            string         `yaml:"data_dir"`
+	AllowedExtensions  []string       `yaml:"allowed_extensions"`
+	MaxConcurrentTasks int            `yaml:"max_concurrent_tasks"`
+	DownloadTimeout    time.Duration  `yaml:"download_timeout"`
+	Log                Log            `yaml:"log"`
+	Reload             Reload         `yaml:"reload"`
+	Admin              Admin          `yaml:"admin"`
+	Health             Health         `yaml:"health"`
+	Tracing            Tracing        `yaml:"tracing"`
+	Audit              Audit          `yaml:"audit"`
+	Store              Store          `yaml:"store"`
+	Journal            Journal        `yaml:"journal"`
+	ArchiveStorage     ArchiveStorage `yaml:"archive_storage"`
+	Cluster            Cluster        `yaml:"cluster"`
+}
+
+type Log struct {
+	Level    string            `yaml:"level"`
+	Format   string            `yaml:"format"`
+	Output   string            `yaml:"output"`
+	File     LogFile           `yaml:"file"`
+	Packages map[string]string `yaml:"packages"`
+}
+
+type LogFile struct {
+	Path       string `yaml:"path"`
+	MaxSizeMB  int    `yaml:"max_size_mb"`
+	MaxBackups int    `yaml:"max_backups"`
+	MaxAgeDays int    `yaml:"max_age_days"`
+	Compress   bool   `yaml:"compress"`
+}
+
+type Reload struct {
+	Watch    bool          `yaml:"watch"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+type Admin struct {
+	Token string `yaml:"token"`
+}
+
+type Health struct {
+	// MinFreeDiskMB is the free space under data_dir below which readiness
+	// fails and tasks fail before building their archive; 0 disables both.
+	MinFreeDiskMB int64 `yaml:"min_free_disk_mb"`
+}
+
+func (h Health) MinFreeDiskBytes() uint64 {
+	return uint64(h.MinFreeDiskMB) << 20
+}
+
+type Audit struct {
+	Enabled   bool `yaml:"enabled"`
+	MaxSizeMB int  `yaml:"max_size_mb"`
+}
+
+type Store struct {
+	Driver        string `yaml:"driver"`
+	Path          string `yaml:"path"`
+	FailOnCorrupt bool   `yaml:"fail_on_corrupt"`
+}
+
+type Journal struct {
+	Enabled         bool          `yaml:"enabled"`
+	CompactEvery    int           `yaml:"compact_every"`
+	CompactInterval time.Duration `yaml:"compact_interval"`
+}
+
+type ArchiveStorage struct {
+	Driver string `yaml:"driver"`
+	// Download is proxy (stream through workmate) or redirect (302 to a
+	// presigned url, s3 only).
+	Download   string        `yaml:"download"`
+	PresignTTL time.Duration `yaml:"presign_ttl"`
+	// QuotaMB caps the total size of ready archives under data_dir; 0 is
+	// unlimited.
+	QuotaMB int64 `yaml:"quota_mb"`
+	S3      S3    `yaml:"s3"`
+}
+
+// Cluster lets several instances share data_dir. It needs the file store
+// and no journal, since both keep state private to one process.
+type Cluster struct {
+	Enabled    bool   `yaml:"enabled"`
+	InstanceID string `yaml:"instance_id"`
+	// LeaseTTL is how long a task stays claimed by an instance that stopped
+	// renewing its lease.
+	LeaseTTL time.Duration `yaml:"lease_ttl"`
+	// MaxConcurrentTasks caps tasks in progress across all instances; 0
+	// leaves only max_concurrent_tasks per instance.
+	MaxConcurrentTasks int           `yaml:"max_concurrent_tasks"`
+	CacheTTL           time.Duration `yaml:"cache_ttl"`
+}
+
+type S3 struct {
+	Endpoint        string `yaml:"endpoint"`
+	Bucket          string `yaml:"bucket"`
+	Region          string `yaml:"region"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	UseSSL          bool   `yaml:"use_ssl"`
+	Prefix          string `yaml:"prefix"`
+}
+
+type Tracing struct {
+	Enabled     bool    `yaml:"enabled"`
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	FilePath    string  `yaml:"file_path"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+	ServiceName string  `yaml:"service_name"`
 }
 
 func Default() Config {
@@ -28,40 +167,224 @@ func Default() Config {
 		DataDir:            defaultDataDir,
 		AllowedExtensions:  []string{".pdf", ".jpeg", ".jpg"},
 		MaxConcurrentTasks: defaultMaxConcurrentTasks,
+		DownloadTimeout:    defaultDownloadTimeout,
+		Log: Log{
+			Level:  defaultLogLevel,
+			Format: "console",
+			Output: "stderr",
+			File: LogFile{
+				Path:       defaultLogFile,
+				MaxSizeMB:  100,
+				MaxBackups: 5,
+				MaxAgeDays: 30,
+			},
+		},
+		Reload: Reload{Interval: defaultReloadInterval},
+		Health: Health{MinFreeDiskMB: defaultMinFreeDiskMB},
+		Tracing: Tracing{
+			Exporter:    defaultTracingExporter,
+			Endpoint:    defaultTracingEndpoint,
+			SampleRatio: 1,
+			ServiceName: defaultTracingServiceName,
+		},
+		Audit: Audit{Enabled: true, MaxSizeMB: defaultAuditMaxSizeMB},
+		Store: Store{Driver: "file"},
+		Journal: Journal{
+			CompactEvery:    defaultJournalCompactEvery,
+			CompactInterval: defaultJournalCompactInterval,
+		},
+		ArchiveStorage: ArchiveStorage{
+			Driver:     "local",
+			Download:   "proxy",
+			PresignTTL: defaultPresignTTL,
+			S3:         S3{Region: "us-east-1", UseSSL: true},
+		},
+		Cluster: Cluster{LeaseTTL: defaultLeaseTTL},
 	}
 }
 
 func Load(path string) (Config, error) {
-	cfg := Default()
-	if path == "" {
-		return cfg, errors.New("empty config path")
-	}
-	fileData, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return cfg, nil
+	cfg, _, err := Loader{Path: path}.Load()
+	return cfg, err
+}
+
+// validate normalizes cfg in place and reports every out-of-range field.
+func validate(cfg *Config) []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...any) {
+		issues = append(issues, Issue{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		add("port", "must be between 1 and 65535, got %d", cfg.Port)
+	}
+	cfg.DataDir = strings.TrimSpace(cfg.DataDir)
+	if cfg.DataDir == "" {
+		add("data_dir", "must not be empty")
+	}
+	if len(cfg.AllowedExtensions) == 0 {
+		add("allowed_extensions", "must list at least one extension")
+	} else {
+		cfg.AllowedExtensions = normalizeExtensions(cfg.AllowedExtensions)
+		for _, ext := range cfg.AllowedExtensions {
+			if !extensionPattern.MatchString(ext) {
+				add("allowed_extensions", "invalid extension %q", ext)
+			}
 		}
-		return cfg, fmt.Errorf("read config: %w", err)
 	}
-	if len(fileData) == 0 {
-		return cfg, nil
+	if cfg.MaxConcurrentTasks < 1 || cfg.MaxConcurrentTasks > maxConcurrentTasksLimit {
+		add("max_concurrent_tasks", "must be between 1 and %d, got %d", maxConcurrentTasksLimit, cfg.MaxConcurrentTasks)
 	}
-	if err := yaml.Unmarshal(fileData, &cfg); err != nil {
-		return cfg, fmt.Errorf("parse yaml: %w", err)
+	if cfg.DownloadTimeout < time.Second || cfg.DownloadTimeout > maxDownloadTimeout {
+		add("download_timeout", "must be between 1s and %s, got %s", maxDownloadTimeout, cfg.DownloadTimeout)
 	}
 
-	if cfg.Port == 0 {
-		cfg.Port = defaultPort
+	cfg.Log.Level = strings.ToLower(strings.TrimSpace(cfg.Log.Level))
+	if !validLogLevel(cfg.Log.Level) {
+		add("log.level", "must be one of %s, got %q", logLevels, cfg.Log.Level)
 	}
-	if cfg.DataDir == "" {
-		cfg.DataDir = defaultDataDir
+	cfg.Log.Format = strings.ToLower(strings.TrimSpace(cfg.Log.Format))
+	if cfg.Log.Format != "console" && cfg.Log.Format != "json" {
+		add("log.format", "must be console or json, got %q", cfg.Log.Format)
+	}
+	cfg.Log.Output = strings.ToLower(strings.TrimSpace(cfg.Log.Output))
+	switch cfg.Log.Output {
+	case "stderr", "stdout":
+	case "file":
+		if strings.TrimSpace(cfg.Log.File.Path) == "" {
+			add("log.file.path", "is required when log.output is file")
+		}
+	default:
+		add("log.output", "must be stderr, stdout or file, got %q", cfg.Log.Output)
+	}
+	if cfg.Log.File.MaxSizeMB < 1 {
+		add("log.file.max_size_mb", "must be >= 1, got %d", cfg.Log.File.MaxSizeMB)
+	}
+	if cfg.Log.File.MaxBackups < 0 {
+		add("log.file.max_backups", "must be >= 0, got %d", cfg.Log.File.MaxBackups)
+	}
+	if cfg.Log.File.MaxAgeDays < 0 {
+		add("log.file.max_age_days", "must be >= 0, got %d", cfg.Log.File.MaxAgeDays)
+	}
+	for pkg, level := range cfg.Log.Packages {
+		level = strings.ToLower(strings.TrimSpace(level))
+		cfg.Log.Packages[pkg] = level
+		if strings.TrimSpace(pkg) == "" {
+			add("log.packages", "package name must not be empty")
+		} else if !validLogLevel(level) {
+			add("log.packages", "level for %s must be one of %s, got %q", pkg, logLevels, level)
+		}
+	}
+	if cfg.Reload.Interval < minReloadInterval {
+		add("reload.interval", "must be at least %s, got %s", minReloadInterval, cfg.Reload.Interval)
+	}
+
+	cfg.Admin.Token = strings.TrimSpace(cfg.Admin.Token)
+	if cfg.Admin.Token != "" && len(cfg.Admin.Token) < minAdminTokenLength {
+		add("admin.token", "must be at least %d characters when set", minAdminTokenLength)
+	}
+	if cfg.Health.MinFreeDiskMB < 0 {
+		add("health.min_free_disk_mb", "must be >= 0, got %d", cfg.Health.MinFreeDiskMB)
+	}
+
+	t := &cfg.Tracing
+	t.Exporter = strings.ToLower(strings.TrimSpace(t.Exporter))
+	switch t.Exporter {
+	case "otlp":
+		if t.Endpoint == "" {
+			add("tracing.endpoint", "must not be empty for the otlp exporter")
+		}
+	case "stdout":
+	case "file":
+		if t.FilePath == "" {
+			add("tracing.file_path", "is required for the file exporter")
+		}
+	default:
+		add("tracing.exporter", "must be otlp, stdout or file, got %q", t.Exporter)
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		add("tracing.sample_ratio", "must be between 0 and 1, got %v", t.SampleRatio)
+	}
+	if strings.TrimSpace(t.ServiceName) == "" {
+		add("tracing.service_name", "must not be empty")
+	}
+	if cfg.Audit.MaxSizeMB < 1 {
+		add("audit.max_size_mb", "must be >= 1, got %d", cfg.Audit.MaxSizeMB)
 	}
+	cfg.Store.Driver = strings.ToLower(strings.TrimSpace(cfg.Store.Driver))
+	if cfg.Store.Driver != "file" && cfg.Store.Driver != "bolt" {
+		add("store.driver", "must be file or bolt, got %q", cfg.Store.Driver)
+	}
+	cfg.Store.Path = strings.TrimSpace(cfg.Store.Path)
+	if cfg.Journal.CompactEvery < 1 {
+		add("journal.compact_every", "must be >= 1, got %d", cfg.Journal.CompactEvery)
+	}
+	if cfg.Journal.CompactInterval < minJournalCompactInterval {
+		add("journal.compact_interval", "must be at least %s, got %s", minJournalCompactInterval, cfg.Journal.CompactInterval)
+	}
+
+	as := &cfg.ArchiveStorage
+	as.Driver = strings.ToLower(strings.TrimSpace(as.Driver))
+	switch as.Driver {
+	case "local":
+	case "s3":
+		as.S3.Endpoint = strings.TrimSpace(as.S3.Endpoint)
+		if as.S3.Endpoint == "" {
+			add("archive_storage.s3.endpoint", "is required for the s3 driver")
+		} else if strings.Contains(as.S3.Endpoint, "://") {
+			add("archive_storage.s3.endpoint", "must be host[:port] without a scheme, got %q", as.S3.Endpoint)
+		}
+		if strings.TrimSpace(as.S3.Bucket) == "" {
+			add("archive_storage.s3.bucket", "is required for the s3 driver")
+		}
+	default:
+		add("archive_storage.driver", "must be local or s3, got %q", as.Driver)
+	}
+	as.Download = strings.ToLower(strings.TrimSpace(as.Download))
+	switch as.Download {
+	case "proxy":
+	case "redirect":
+		if as.Driver != "s3" {
+			add("archive_storage.download", "redirect requires the s3 driver")
+		}
+	default:
+		add("archive_storage.download", "must be proxy or redirect, got %q", as.Download)
+	}
+	if as.PresignTTL < time.Second || as.PresignTTL > maxPresignTTL {
+		add("archive_storage.presign_ttl", "must be between 1s and %s, got %s", maxPresignTTL, as.PresignTTL)
+	}
+	if as.QuotaMB < 0 {
+		add("archive_storage.quota_mb", "must be >= 0, got %d", as.QuotaMB)
+	}
+
+	cl := &cfg.Cluster
+	cl.InstanceID = strings.TrimSpace(cl.InstanceID)
+	if cl.LeaseTTL < minLeaseTTL {
+		add("cluster.lease_ttl", "must be at least %s, got %s", minLeaseTTL, cl.LeaseTTL)
+	}
+	if cl.MaxConcurrentTasks < 0 || cl.MaxConcurrentTasks > maxConcurrentTasksLimit {
+		add("cluster.max_concurrent_tasks", "must be between 0 and %d, got %d", maxConcurrentTasksLimit, cl.MaxConcurrentTasks)
+	}
+	if cl.CacheTTL < 0 {
+		add("cluster.cache_ttl", "must be >= 0, got %s", cl.CacheTTL)
+	}
+	if cl.Enabled && cfg.Store.Driver == "bolt" {
+		add("cluster.enabled", "requires store.driver file")
+	}
+	if cl.Enabled && cfg.Journal.Enabled {
+		add("cluster.enabled", "cannot be combined with journal.enabled")
+	}
+	return issues
+}
+
+const logLevels = "trace, debug, info, warn, error, fatal, panic, disabled"
 
-	if cfg.MaxConcurrentTasks < 1 {
-		return cfg, fmt.Errorf("invalid max_concurrent_tasks: %d (must be >= 1)", cfg.MaxConcurrentTasks)
+func validLogLevel(level string) bool {
+	if level == "" {
+		return false
 	}
-	cfg.AllowedExtensions = normalizeExtensions(cfg.AllowedExtensions)
-	return cfg, nil
+	_, err := zerolog.ParseLevel(level)
+	return err == nil
 }
 
 func normalizeExtensions(in []string) []string {
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -54,6 +56,21 @@ func TestLoadReadsAndValidates(t *testing.T) {
 	}
 }
 
+func TestLoadHealthThreshold(t *testing.T) {
+	if got := Default().Health.MinFreeDiskBytes(); got != defaultMinFreeDiskMB<<20 {
+		t.Fatalf("unexpected default threshold: %d", got)
+	}
+
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "cfg.yml")
+	if err := os.WriteFile(path, []byte("health:\n  min_free_disk_mb: -1\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatalf("expected error for negative disk threshold")
+	}
+}
+
 func TestLoadRejectsInvalidConcurrency(t *testing.T) {
 	tempDir := t.TempDir()
 	path := filepath.Join(tempDir, "cfg.yml")
@@ -65,3 +82,277 @@ func TestLoadRejectsInvalidConcurrency(t *testing.T) {
 		t.Fatalf("expected error for invalid concurrency")
 	}
 }
+
+func TestLoadTracing(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "cfg.yml")
+	content := []byte("tracing:\n  enabled: true\n  exporter: STDOUT\n  sample_ratio: 0.25\n")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !cfg.Tracing.Enabled || cfg.Tracing.Exporter != "stdout" || cfg.Tracing.SampleRatio != 0.25 {
+		t.Fatalf("unexpected tracing cfg: %+v", cfg.Tracing)
+	}
+	if cfg.Tracing.ServiceName != defaultTracingServiceName {
+		t.Fatalf("expected default service name, got %q", cfg.Tracing.ServiceName)
+	}
+
+	if Default().Tracing.SampleRatio != 1 {
+		t.Fatalf("expected default sample ratio 1")
+	}
+
+	for _, bad := range []string{
+		"tracing:\n  exporter: jaeger\n",
+		"tracing:\n  sample_ratio: 1.5\n",
+		"tracing:\n  enabled: true\n  exporter: file\n",
+	} {
+		if err := os.WriteFile(path, []byte(bad), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadArchiveStorage(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "cfg.yml")
+	content := []byte("archive_storage:\n  driver: S3\n  download: redirect\n  s3:\n    endpoint: localhost:9000\n    bucket: archives\n    secret_access_key: topsecret\n")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	as := cfg.ArchiveStorage
+	if as.Driver != "s3" || as.Download != "redirect" || as.PresignTTL != defaultPresignTTL || !as.S3.UseSSL {
+		t.Fatalf("unexpected archive storage cfg: %+v", as)
+	}
+	for _, s := range Describe(cfg, Sources{}) {
+		if s.Key == "archive_storage.s3.secret_access_key" && s.Value != "***" {
+			t.Fatalf("secret leaked: %q", s.Value)
+		}
+	}
+
+	for _, bad := range []string{
+		"archive_storage:\n  driver: gcs\n",
+		"archive_storage:\n  download: redirect\n",
+		"archive_storage:\n  driver: s3\n  s3:\n    bucket: b\n",
+		"archive_storage:\n  driver: s3\n  s3:\n    endpoint: http://minio:9000\n    bucket: b\n",
+		"archive_storage:\n  presign_ttl: 200h\n",
+	} {
+		if err := os.WriteFile(path, []byte(bad), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadCluster(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "cfg.yml")
+	content := []byte("cluster:\n  enabled: true\n  instance_id: ' node-a '\n  max_concurrent_tasks: 4\n")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	cl := cfg.Cluster
+	if !cl.Enabled || cl.InstanceID != "node-a" || cl.LeaseTTL != defaultLeaseTTL || cl.MaxConcurrentTasks != 4 {
+		t.Fatalf("unexpected cluster cfg: %+v", cl)
+	}
+
+	for _, bad := range []string{
+		"cluster:\n  lease_ttl: 100ms\n",
+		"cluster:\n  max_concurrent_tasks: -1\n",
+		"cluster:\n  enabled: true\nstore:\n  driver: bolt\n",
+		"cluster:\n  enabled: true\njournal:\n  enabled: true\n",
+	} {
+		if err := os.WriteFile(path, []byte(bad), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestReconcileSplitsLiveAndRestartFields(t *testing.T) {
+	current := Default()
+	next := Default()
+	next.Port = 9999
+	next.MaxConcurrentTasks = 10
+	next.Log.Level = "debug"
+	next.Admin.Token = "new"
+
+	applied, live, rejected := Reconcile(current, next)
+	if applied.Port != current.Port || applied.MaxConcurrentTasks != 10 || applied.Log.Level != "debug" || applied.Admin.Token != "" {
+		t.Fatalf("unexpected applied config: %+v", applied)
+	}
+	if len(live) != 2 || len(rejected) != 2 {
+		t.Fatalf("expected 2 live and 2 rejected changes, got %+v / %+v", live, rejected)
+	}
+	for _, c := range rejected {
+		if c.Field == "admin.token" && (c.Old != "***" || c.New != "***") {
+			t.Fatalf("admin token must be redacted, got %+v", c)
+		}
+	}
+}
+
+func TestLoaderPrecedenceAndSources(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "cfg.yml")
+	content := []byte("port: 9090\ndata_dir: from-file\nmax_concurrent_tasks: 2\ntracing:\n  endpoint: file:4318\n")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	env := map[string]string{
+		"WORKMATE_PORT":               "7070",
+		"WORKMATE_DATA_DIR":           "from-env",
+		"WORKMATE_ALLOWED_EXTENSIONS": "pdf, png",
+		"WORKMATE_TRACING_ENABLED":    "true",
+		"WORKMATE_DOWNLOAD_TIMEOUT":   "5s",
+	}
+	loader := Loader{
+		Path:      path,
+		LookupEnv: func(k string) (string, bool) { v, ok := env[k]; return v, ok },
+		Flags:     map[string]string{"port": "6060"},
+	}
+	cfg, sources, err := loader.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Port != 6060 || cfg.DataDir != "from-env" || cfg.MaxConcurrentTasks != 2 || !cfg.Tracing.Enabled {
+		t.Fatalf("unexpected cfg: %+v", cfg)
+	}
+	if cfg.DownloadTimeout.String() != "5s" || len(cfg.AllowedExtensions) != 2 || cfg.AllowedExtensions[1] != ".png" {
+		t.Fatalf("env values not applied: %+v", cfg)
+	}
+	want := map[string]Source{
+		"port":                 SourceFlag,
+		"data_dir":             SourceEnv,
+		"max_concurrent_tasks": SourceFile,
+		"tracing.endpoint":     SourceFile,
+		"tracing.enabled":      SourceEnv,
+		"log.level":            SourceDefault,
+	}
+	for key, src := range want {
+		if sources[key] != src {
+			t.Fatalf("source of %s = %s, want %s", key, sources[key], src)
+		}
+	}
+
+	env["WORKMATE_MAX_CONCURRENT_TASKS"] = "many"
+	if _, _, err := loader.Load(); err == nil || !strings.Contains(err.Error(), "WORKMATE_MAX_CONCURRENT_TASKS") {
+		t.Fatalf("expected error naming the env var, got %v", err)
+	}
+}
+
+func TestDescribeRedactsToken(t *testing.T) {
+	cfg := Default()
+	cfg.Admin.Token = "secret"
+	for _, s := range Describe(cfg, Sources{}) {
+		if s.Key == "admin.token" && s.Value != "***" {
+			t.Fatalf("token leaked: %q", s.Value)
+		}
+	}
+}
+
+func TestLoadStrictReportsAllIssuesWithLines(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "cfg.yml")
+	content := "port: 70000\nalowed_extensions: [pdf]\nmax_concurrent_tasks: many\ntracing:\n  endpont: x\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_, err := Load(path)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	want := map[string]int{"port": 1, "alowed_extensions": 2, "max_concurrent_tasks": 3, "tracing.endpont": 5}
+	if len(verr.Issues) != len(want) {
+		t.Fatalf("expected %d issues, got %+v", len(want), verr.Issues)
+	}
+	for _, issue := range verr.Issues {
+		if line, ok := want[issue.Key]; !ok || issue.Line != line {
+			t.Fatalf("unexpected issue %+v", issue)
+		}
+	}
+	if !strings.Contains(verr.Issues[1].Message, `"allowed_extensions"`) {
+		t.Fatalf("expected a suggestion for the typo, got %q", verr.Issues[1].Message)
+	}
+}
+
+func TestLoadRangeChecks(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "cfg.yml")
+	for _, bad := range []string{
+		"port: 0\n",
+		"data_dir: \"\"\n",
+		"allowed_extensions: []\n",
+		"allowed_extensions: [\"p d f\"]\n",
+		"max_concurrent_tasks: 1000\n",
+		"download_timeout: 2h\n",
+		"reload:\n  interval: 1ms\n",
+		"admin:\n  token: short\n",
+		"tracing: 5\n",
+		"- a\n- b\n",
+		"log:\n  level: \"\"\n",
+	} {
+		if err := os.WriteFile(path, []byte(bad), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadLogSettings(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "cfg.yml")
+	content := "log:\n  level: WARN\n  format: json\n  output: file\n  file:\n    path: logs/app.log\n  packages:\n    archive: DEBUG\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	env := map[string]string{"WORKMATE_LOG_PACKAGES": "task=trace, archive=debug"}
+	cfg, _, err := Loader{
+		Path:      path,
+		LookupEnv: func(k string) (string, bool) { v, ok := env[k]; return v, ok },
+	}.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Log.Level != "warn" || cfg.Log.Format != "json" || cfg.Log.File.Path != "logs/app.log" || cfg.Log.File.MaxSizeMB != 100 {
+		t.Fatalf("unexpected log cfg: %+v", cfg.Log)
+	}
+	if len(cfg.Log.Packages) != 2 || cfg.Log.Packages["task"] != "trace" {
+		t.Fatalf("env should override packages, got %v", cfg.Log.Packages)
+	}
+
+	for _, bad := range []string{
+		"log:\n  format: xml\n",
+		"log:\n  output: syslog\n",
+		"log:\n  output: file\n  file:\n    path: \"\"\n",
+		"log:\n  packages:\n    archive: chatty\n",
+		"log:\n  file:\n    max_size_mb: 0\n",
+	} {
+		if err := os.WriteFile(path, []byte(bad), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
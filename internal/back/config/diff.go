@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Reconcile returns the config that can be applied to a running process:
+// fields that are safe to change live are taken from next, everything else
+// keeps the current value and is reported as rejected.
+func Reconcile(current, next Config) (Config, []Change, []Change) {
+	applied := current
+	var live, rejected []Change
+
+	if !slices.Equal(current.AllowedExtensions, next.AllowedExtensions) {
+		live = append(live, change("allowed_extensions", current.AllowedExtensions, next.AllowedExtensions))
+		applied.AllowedExtensions = next.AllowedExtensions
+	}
+	if current.MaxConcurrentTasks != next.MaxConcurrentTasks {
+		live = append(live, change("max_concurrent_tasks", current.MaxConcurrentTasks, next.MaxConcurrentTasks))
+		applied.MaxConcurrentTasks = next.MaxConcurrentTasks
+	}
+	if current.DownloadTimeout != next.DownloadTimeout {
+		live = append(live, change("download_timeout", current.DownloadTimeout, next.DownloadTimeout))
+		applied.DownloadTimeout = next.DownloadTimeout
+	}
+	if current.Log.Level != next.Log.Level {
+		live = append(live, change("log.level", current.Log.Level, next.Log.Level))
+		applied.Log.Level = next.Log.Level
+	}
+	if !maps.Equal(current.Log.Packages, next.Log.Packages) {
+		live = append(live, Change{Field: "log.packages", Old: formatLevels(current.Log.Packages), New: formatLevels(next.Log.Packages)})
+		applied.Log.Packages = next.Log.Packages
+	}
+
+	if current.Port != next.Port {
+		rejected = append(rejected, change("port", current.Port, next.Port))
+	}
+	if current.DataDir != next.DataDir {
+		rejected = append(rejected, change("data_dir", current.DataDir, next.DataDir))
+	}
+	if current.Log.Format != next.Log.Format {
+		rejected = append(rejected, change("log.format", current.Log.Format, next.Log.Format))
+	}
+	if current.Log.Output != next.Log.Output {
+		rejected = append(rejected, change("log.output", current.Log.Output, next.Log.Output))
+	}
+	if current.Log.File != next.Log.File {
+		rejected = append(rejected, change("log.file", current.Log.File, next.Log.File))
+	}
+	if current.Reload != next.Reload {
+		rejected = append(rejected, change("reload", current.Reload, next.Reload))
+	}
+	if current.Admin.Token != next.Admin.Token {
+		rejected = append(rejected, Change{Field: "admin.token", Old: "***", New: "***"})
+	}
+	if current.Health != next.Health {
+		rejected = append(rejected, change("health", current.Health, next.Health))
+	}
+	if current.Tracing != next.Tracing {
+		rejected = append(rejected, Change{Field: "tracing", Old: tracingString(current.Tracing), New: tracingString(next.Tracing)})
+	}
+	if current.Audit != next.Audit {
+		rejected = append(rejected, change("audit", current.Audit, next.Audit))
+	}
+	if current.Store != next.Store {
+		rejected = append(rejected, change("store", current.Store, next.Store))
+	}
+	if current.Journal != next.Journal {
+		rejected = append(rejected, change("journal", current.Journal, next.Journal))
+	}
+	if current.ArchiveStorage != next.ArchiveStorage {
+		rejected = append(rejected, Change{Field: "archive_storage", Old: archiveStorageString(current.ArchiveStorage), New: archiveStorageString(next.ArchiveStorage)})
+	}
+	if current.Cluster != next.Cluster {
+		rejected = append(rejected, change("cluster", current.Cluster, next.Cluster))
+	}
+	return applied, live, rejected
+}
+
+func change(field string, old, new any) Change {
+	return Change{Field: field, Old: fmt.Sprint(old), New: fmt.Sprint(new)}
+}
+
+func formatLevels(levels map[string]string) string {
+	keys := make([]string, 0, len(levels))
+	for k := range levels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + levels[k]
+	}
+	return strings.Join(parts, ",")
+}
+
+func tracingString(t Tracing) string {
+	return strings.Join([]string{
+		fmt.Sprintf("enabled=%t", t.Enabled),
+		"exporter=" + t.Exporter,
+		"endpoint=" + t.Endpoint,
+		fmt.Sprintf("sample_ratio=%v", t.SampleRatio),
+	}, " ")
+}
+
+// archiveStorageString leaves out the s3 credentials.
+func archiveStorageString(s ArchiveStorage) string {
+	return strings.Join([]string{
+		"driver=" + s.Driver,
+		"download=" + s.Download,
+		"presign_ttl=" + s.PresignTTL.String(),
+		fmt.Sprintf("quota_mb=%d", s.QuotaMB),
+		"endpoint=" + s.S3.Endpoint,
+		"bucket=" + s.S3.Bucket,
+		"prefix=" + s.S3.Prefix,
+	}, " ")
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const EnvPrefix = "WORKMATE_"
+
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Sources maps a dotted config key (e.g. "tracing.endpoint") to the layer
+// its effective value came from.
+type Sources map[string]Source
+
+type Setting struct {
+	Key    string
+	Value  string
+	Source Source
+}
+
+// Loader layers configuration: defaults < file < WORKMATE_* env < flags.
+type Loader struct {
+	Path      string
+	LookupEnv func(key string) (string, bool)
+	Flags     map[string]string
+}
+
+type field struct {
+	key   string
+	index []int
+}
+
+var fields = collectFields(reflect.TypeOf(Config{}), "", nil)
+
+func collectFields(t reflect.Type, prefix string, index []int) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		idx := append(append([]int(nil), index...), i)
+		if f.Type.Kind() == reflect.Struct && f.Type.PkgPath() == t.PkgPath() {
+			out = append(out, collectFields(f.Type, prefix+tag+".", idx)...)
+			continue
+		}
+		out = append(out, field{key: prefix + tag, index: idx})
+	}
+	return out
+}
+
+func lookupField(key string) (field, bool) {
+	for _, f := range fields {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+func (l Loader) Load() (Config, Sources, error) {
+	cfg := Default()
+	sources := make(Sources, len(fields))
+	for _, f := range fields {
+		sources[f.key] = SourceDefault
+	}
+	if l.Path == "" {
+		return cfg, sources, errors.New("empty config path")
+	}
+
+	positions, issues, err := loadFile(l.Path, &cfg, sources)
+	if err != nil {
+		return cfg, sources, err
+	}
+
+	if l.LookupEnv != nil {
+		for _, f := range fields {
+			name := EnvName(f.key)
+			raw, ok := l.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			if err := setField(&cfg, f, raw); err != nil {
+				issues = append(issues, Issue{Key: f.key, Message: fmt.Sprintf("invalid value in %s: %v", name, err)})
+				continue
+			}
+			sources[f.key] = SourceEnv
+		}
+	}
+
+	keys := make([]string, 0, len(l.Flags))
+	for key := range l.Flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f, ok := lookupField(key)
+		if !ok {
+			issues = append(issues, Issue{Key: key, Message: "unknown config key"})
+			continue
+		}
+		if err := setField(&cfg, f, l.Flags[key]); err != nil {
+			issues = append(issues, Issue{Key: key, Message: fmt.Sprintf("invalid flag value: %v", err)})
+			continue
+		}
+		sources[key] = SourceFlag
+	}
+
+	for _, issue := range validate(&cfg) {
+		if sources[issue.Key] == SourceFile {
+			pos := positions[issue.Key]
+			issue.Line, issue.Column = pos.Line, pos.Column
+		}
+		issues = append(issues, issue)
+	}
+	if len(issues) > 0 {
+		sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+		return cfg, sources, &ValidationError{Path: l.Path, Issues: issues}
+	}
+	return cfg, sources, nil
+}
+
+type position struct {
+	Line   int
+	Column int
+}
+
+// loadFile decodes the file strictly: unknown keys, duplicates and values of
+// the wrong type are reported as issues with their position instead of
+// being silently ignored.
+func loadFile(path string, cfg *Config, sources Sources) (map[string]position, []Issue, error) {
+	positions := make(map[string]position)
+	fileData, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return positions, nil, nil
+		}
+		return positions, nil, fmt.Errorf("read config: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(fileData, &doc); err != nil {
+		return positions, nil, &ValidationError{Path: path, Issues: []Issue{{Message: err.Error()}}}
+	}
+	if len(doc.Content) == 0 {
+		return positions, nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return positions, []Issue{{Line: root.Line, Column: root.Column, Message: "config must be a mapping"}}, nil
+	}
+	d := fileDecoder{cfg: cfg, sources: sources, positions: positions}
+	d.walk(root, "")
+	return positions, d.issues, nil
+}
+
+type fileDecoder struct {
+	cfg       *Config
+	sources   Sources
+	positions map[string]position
+	issues    []Issue
+}
+
+func (d *fileDecoder) walk(node *yaml.Node, prefix string) {
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		key := prefix + keyNode.Value
+		issueAt := func(msg string) {
+			d.issues = append(d.issues, Issue{Line: keyNode.Line, Column: keyNode.Column, Key: key, Message: msg})
+		}
+		if seen[key] {
+			issueAt("duplicate key")
+			continue
+		}
+		seen[key] = true
+
+		if f, ok := lookupField(key); ok {
+			d.positions[key] = position{Line: valueNode.Line, Column: valueNode.Column}
+			v := reflect.ValueOf(d.cfg).Elem().FieldByIndex(f.index)
+			if err := valueNode.Decode(v.Addr().Interface()); err != nil {
+				d.issues = append(d.issues, Issue{Line: valueNode.Line, Column: valueNode.Column, Key: key, Message: decodeMessage(err)})
+				continue
+			}
+			d.sources[key] = SourceFile
+			continue
+		}
+		if isSection(key) {
+			if valueNode.Kind != yaml.MappingNode {
+				if valueNode.Tag != "!!null" {
+					issueAt("must be a mapping")
+				}
+				continue
+			}
+			d.walk(valueNode, key+".")
+			continue
+		}
+
+		msg := "unknown field"
+		if hint := suggestKey(key, allKeys()); hint != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", hint)
+		}
+		issueAt(msg)
+	}
+}
+
+func decodeMessage(err error) string {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		msg := typeErr.Errors[0]
+		if idx := strings.Index(msg, ": "); idx >= 0 && strings.HasPrefix(msg, "line ") {
+			msg = msg[idx+2:]
+		}
+		return msg
+	}
+	return err.Error()
+}
+
+func isSection(key string) bool {
+	for _, f := range fields {
+		if strings.HasPrefix(f.key, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func allKeys() []string {
+	keys := make([]string, 0, len(fields))
+	for _, f := range fields {
+		keys = append(keys, f.key)
+	}
+	return keys
+}
+
+func setField(cfg *Config, f field, raw string) error {
+	v := reflect.ValueOf(cfg).Elem().FieldByIndex(f.index)
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+		return nil
+	case v.Kind() == reflect.Map && v.Type().Elem().Kind() == reflect.String:
+		items := make(map[string]string)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			k, val, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", item)
+			}
+			items[strings.TrimSpace(k)] = strings.TrimSpace(val)
+		}
+		v.Set(reflect.ValueOf(items))
+		return nil
+	default:
+		return yaml.Unmarshal([]byte(raw), v.Addr().Interface())
+	}
+}
+
+func Describe(cfg Config, sources Sources) []Setting {
+	root := reflect.ValueOf(cfg)
+	settings := make([]Setting, 0, len(fields))
+	for _, f := range fields {
+		value := formatValue(root.FieldByIndex(f.index))
+		if (f.key == "admin.token" || f.key == "archive_storage.s3.secret_access_key") && value != "" {
+			value = "***"
+		}
+		settings = append(settings, Setting{Key: f.key, Value: value, Source: sources[f.key]})
+	}
+	return settings
+}
+
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return ""
+		}
+		return formatValue(v.Elem())
+	case reflect.Slice:
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	case reflect.Map:
+		parts := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			parts = append(parts, fmt.Sprintf("%v=%v", k.Interface(), v.MapIndex(k).Interface()))
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package file
+
+import "errors"
+
+var ErrFreeSpaceUnsupported = errors.New("free space check is not supported on this platform")
+
+func FreeSpace(string) (uint64, error) {
+	return 0, ErrFreeSpaceUnsupported
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package file
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func FreeSpace(dirPath string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dirPath, &stat); err != nil {
+		return 0, fmt.Errorf("statfs: %w", err)
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -1,6 +1,8 @@
 package file
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -66,6 +68,34 @@ func WriteJSONAtomic(filename string, v any) error {
 	return nil
 }
 
+// SHA256 returns the hex sha256 digest and the size of the file at path.
+func SHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// SyncFile flushes the contents of the file at path to disk.
+func SyncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("sync %s: %w", path, err)
+	}
+	return f.Close()
+}
+
 func CopyAtomic(filename string, reader io.Reader) error {
 	dir := filepath.Dir(filename)
 	if err := EnsureDir(dir); err != nil {
@@ -98,3 +128,21 @@ func CopyAtomic(filename string, reader io.Reader) error {
 	}
 	return nil
 }
+
+func CheckWritable(dirPath string) error {
+	if dirPath == "" {
+		return errors.New("empty dir path")
+	}
+	probe, err := os.CreateTemp(dirPath, ".probe-*")
+	if err != nil {
+		return fmt.Errorf("create probe: %w", err)
+	}
+	name := probe.Name()
+	_, writeErr := probe.Write([]byte("ok"))
+	closeErr := probe.Close()
+	removeErr := os.Remove(name)
+	if err := errors.Join(writeErr, closeErr, removeErr); err != nil {
+		return fmt.Errorf("write probe: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package file
+
+import (
+	"errors"
+	"os"
+)
+
+var ErrLocked = errors.New("file is locked")
+
+// FileLock is a lock on a file, held until Unlock.
+type FileLock struct {
+	f *os.File
+}
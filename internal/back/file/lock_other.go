@@ -0,0 +1,59 @@
+//go:build !unix
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const lockPollInterval = 50 * time.Millisecond
+
+// Lock falls back to an exclusively created marker file on platforms
+// without flock. A holder that crashes leaves the marker behind, so it must
+// be removed by hand.
+func Lock(path string) (*FileLock, error) {
+	for {
+		l, err := TryLock(path)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+func TryLock(path string) (*FileLock, error) {
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o640)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("open lock: %w", err)
+	}
+	return &FileLock{f: f}, nil
+}
+
+// TryLockShared only checks for an exclusive marker: the fallback cannot
+// count shared holders, so an exclusive locker does not see them.
+func TryLockShared(path string) (*FileLock, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, ErrLocked
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("stat lock: %w", err)
+	}
+	return &FileLock{}, nil
+}
+
+func (l *FileLock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	name := l.f.Name()
+	return errors.Join(l.f.Close(), os.Remove(name))
+}
@@ -0,0 +1,70 @@
+//go:build unix
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Lock takes an exclusive advisory lock on path, creating the file when
+// needed, and blocks until it is held. The lock is shared between processes
+// on the same host or on a shared volume that supports flock.
+func Lock(path string) (*FileLock, error) {
+	return lock(path, syscall.LOCK_EX)
+}
+
+// TryLock is Lock without blocking; it returns ErrLocked when another holder
+// has the file locked.
+func TryLock(path string) (*FileLock, error) {
+	return lock(path, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// TryLockShared takes a shared lock without blocking. Any number of shared
+// holders may coexist; it returns ErrLocked while an exclusive lock is held.
+func TryLockShared(path string) (*FileLock, error) {
+	return lock(path, syscall.LOCK_SH|syscall.LOCK_NB)
+}
+
+func lock(path string, how int) (*FileLock, error) {
+	f, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), how)
+		if !errors.Is(err, syscall.EINTR) {
+			break
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("flock %s: %w", path, err)
+	}
+	return &FileLock{f: f}, nil
+}
+
+func (l *FileLock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	err := syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	return errors.Join(err, l.f.Close())
+}
+
+func openLockFile(path string) (*os.File, error) {
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("open lock: %w", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package file
+
+// SyncDir is a no-op on platforms that cannot fsync a directory.
+func SyncDir(string) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package file
+
+import (
+	"fmt"
+	"os"
+)
+
+// SyncDir flushes a directory entry change, such as a rename into dirPath,
+// to disk.
+func SyncDir(dirPath string) error {
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return fmt.Errorf("open dir: %w", err)
+	}
+	if err := dir.Sync(); err != nil {
+		_ = dir.Close()
+		return fmt.Errorf("sync dir: %w", err)
+	}
+	return dir.Close()
+}
@@ -0,0 +1,60 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckerAggregatesResults(t *testing.T) {
+	c := NewChecker()
+	c.Add("ok", func(context.Context) error { return nil })
+	report := c.Run(context.Background())
+	if !report.OK() || report.Checks["ok"].Status != StatusOK {
+		t.Fatalf("expected ok report, got %+v", report)
+	}
+
+	c.Add("broken", func(context.Context) error { return errors.New("boom") })
+	report = c.Run(context.Background())
+	if report.OK() {
+		t.Fatalf("expected failing report")
+	}
+	if got := report.Checks["broken"]; got.Status != StatusFail || got.Error != "boom" {
+		t.Fatalf("unexpected broken check result: %+v", got)
+	}
+	if report.Checks["ok"].Status != StatusOK {
+		t.Fatalf("healthy check should stay ok")
+	}
+}
+
+func TestCheckerTimesOutSlowChecks(t *testing.T) {
+	c := NewChecker()
+	c.timeout = 20 * time.Millisecond
+	block := make(chan struct{})
+	defer close(block)
+	c.Add("slow", func(context.Context) error { <-block; return nil })
+
+	report := c.Run(context.Background())
+	if report.OK() || report.Checks["slow"].Error == "" {
+		t.Fatalf("expected slow check to time out, got %+v", report)
+	}
+}
+
+func TestDirWritableAndFreeDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	if err := DirWritable(dir)(context.Background()); err != nil {
+		t.Fatalf("expected temp dir to be writable: %v", err)
+	}
+	if err := DirWritable(filepath.Join(dir, "missing"))(context.Background()); err == nil {
+		t.Fatalf("expected missing dir to fail")
+	}
+	if err := FreeDiskSpace(dir, 1)(context.Background()); err != nil {
+		t.Fatalf("expected some free space: %v", err)
+	}
+	if err := FreeDiskSpace(dir, math.MaxUint64)(context.Background()); err == nil {
+		t.Fatalf("expected threshold violation")
+	}
+}
@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+type ctxKey int
+
+const ctxKeyRequestID ctxKey = iota
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKeyRequestID, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxKeyRequestID).(string)
+	return id
+}
+
+// Ctx returns the package logger enriched with the request ID carried by ctx.
+func (l *Logger) Ctx(ctx context.Context) *zerolog.Logger {
+	logger := l.current.Load()
+	id := RequestIDFromContext(ctx)
+	if id == "" {
+		return logger
+	}
+	child := logger.With().Str("request_id", id).Logger()
+	return &child
+}
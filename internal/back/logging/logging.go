@@ -0,0 +1,208 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+
+	OutputStderr = "stderr"
+	OutputStdout = "stdout"
+	OutputFile   = "file"
+)
+
+type FileOptions struct {
+	Path       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+	Compress   bool
+}
+
+type Options struct {
+	Level    string
+	Format   string
+	Output   string
+	File     FileOptions
+	Packages map[string]string
+}
+
+var (
+	mu           sync.Mutex
+	base         = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).With().Timestamp().Logger()
+	defaultLevel = zerolog.InfoLevel
+	pkgLevels    = map[string]zerolog.Level{}
+	loggers      = map[string]*Logger{}
+	output       io.Closer
+)
+
+// Logger is a package-scoped logger whose level can be overridden per
+// package and changed at runtime.
+type Logger struct {
+	name    string
+	current atomic.Pointer[zerolog.Logger]
+}
+
+func Package(name string) *Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	if l, ok := loggers[name]; ok {
+		return l
+	}
+	l := &Logger{name: name}
+	l.rebuildLocked()
+	loggers[name] = l
+	return l
+}
+
+func (l *Logger) rebuildLocked() {
+	level, ok := pkgLevels[l.name]
+	if !ok {
+		level = defaultLevel
+	}
+	logger := base.With().Str("pkg", l.name).Logger().Level(level)
+	l.current.Store(&logger)
+}
+
+func (l *Logger) Logger() *zerolog.Logger { return l.current.Load() }
+func (l *Logger) Trace() *zerolog.Event   { return l.current.Load().Trace() }
+func (l *Logger) Debug() *zerolog.Event   { return l.current.Load().Debug() }
+func (l *Logger) Info() *zerolog.Event    { return l.current.Load().Info() }
+func (l *Logger) Warn() *zerolog.Event    { return l.current.Load().Warn() }
+func (l *Logger) Error() *zerolog.Event   { return l.current.Load().Error() }
+
+func Setup(opts Options) error {
+	writer, closer, err := newWriter(opts)
+	if err != nil {
+		return err
+	}
+	level, levels, err := parseLevels(opts.Level, opts.Packages)
+	if err != nil {
+		if closer != nil {
+			_ = closer.Close()
+		}
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	previous := output
+	base = zerolog.New(writer).With().Timestamp().Logger()
+	output = closer
+	applyLevelsLocked(level, levels)
+	if previous != nil {
+		_ = previous.Close()
+	}
+	return nil
+}
+
+func SetLevels(level string, packages map[string]string) error {
+	parsed, levels, err := parseLevels(level, packages)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	applyLevelsLocked(parsed, levels)
+	mu.Unlock()
+	return nil
+}
+
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if output == nil {
+		return nil
+	}
+	err := output.Close()
+	output = nil
+	return err
+}
+
+// applyLevelsLocked keeps the zerolog global level at the most verbose
+// configured level so that package overrides below the default still pass.
+func applyLevelsLocked(level zerolog.Level, levels map[string]zerolog.Level) {
+	defaultLevel = level
+	pkgLevels = levels
+	minLevel := level
+	for _, l := range levels {
+		if l < minLevel {
+			minLevel = l
+		}
+	}
+	zerolog.SetGlobalLevel(minLevel)
+	log.Logger = base.Level(level)
+	for _, l := range loggers {
+		l.rebuildLocked()
+	}
+}
+
+func parseLevels(level string, packages map[string]string) (zerolog.Level, map[string]zerolog.Level, error) {
+	parsed, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil {
+		return zerolog.NoLevel, nil, fmt.Errorf("log level %q: %w", level, err)
+	}
+	levels := make(map[string]zerolog.Level, len(packages))
+	for pkg, pkgLevel := range packages {
+		l, err := zerolog.ParseLevel(strings.ToLower(pkgLevel))
+		if err != nil {
+			return zerolog.NoLevel, nil, fmt.Errorf("log level %q for package %s: %w", pkgLevel, pkg, err)
+		}
+		levels[pkg] = l
+	}
+	return parsed, levels, nil
+}
+
+func newWriter(opts Options) (io.Writer, io.Closer, error) {
+	var (
+		out    io.Writer
+		closer io.Closer
+	)
+	switch opts.Output {
+	case "", OutputStderr:
+		out = os.Stderr
+	case OutputStdout:
+		out = os.Stdout
+	case OutputFile:
+		if opts.File.Path == "" {
+			return nil, nil, fmt.Errorf("log file path is empty")
+		}
+		if err := os.MkdirAll(filepath.Dir(opts.File.Path), 0o750); err != nil {
+			return nil, nil, fmt.Errorf("log dir: %w", err)
+		}
+		rotator := &lumberjack.Logger{
+			Filename:   opts.File.Path,
+			MaxSize:    opts.File.MaxSizeMB,
+			MaxBackups: opts.File.MaxBackups,
+			MaxAge:     opts.File.MaxAgeDays,
+			Compress:   opts.File.Compress,
+		}
+		out, closer = rotator, rotator
+	default:
+		return nil, nil, fmt.Errorf("unknown log output %q", opts.Output)
+	}
+
+	switch opts.Format {
+	case "", FormatConsole:
+		return zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339, NoColor: opts.Output == OutputFile}, closer, nil
+	case FormatJSON:
+		return out, closer, nil
+	default:
+		if closer != nil {
+			_ = closer.Close()
+		}
+		return nil, nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackageLevelOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "app.log")
+	err := Setup(Options{
+		Level:    "info",
+		Format:   FormatJSON,
+		Output:   OutputFile,
+		File:     FileOptions{Path: path, MaxSizeMB: 1},
+		Packages: map[string]string{"archive": "debug"},
+	})
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = Setup(Options{Level: "info"})
+	})
+
+	archiveLog := Package("archive")
+	taskLog := Package("task")
+	archiveLog.Debug().Msg("archive debug")
+	taskLog.Debug().Msg("task debug")
+	taskLog.Info().Msg("task info")
+
+	if err := SetLevels("warn", nil); err != nil {
+		t.Fatalf("set levels: %v", err)
+	}
+	archiveLog.Debug().Msg("archive debug after reload")
+	taskLog.Info().Msg("task info after reload")
+	if err := Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	out := string(data)
+	for _, want := range []string{`"pkg":"archive"`, "archive debug", "task info"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in log output:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"task debug", "after reload"} {
+		if strings.Contains(out, unwanted) {
+			t.Fatalf("did not expect %q in log output:\n%s", unwanted, out)
+		}
+	}
+}
+
+func TestSetupRejectsInvalidOptions(t *testing.T) {
+	if err := Setup(Options{Level: "loud"}); err == nil {
+		t.Fatalf("expected error for unknown level")
+	}
+	if err := Setup(Options{Level: "info", Format: "xml"}); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+	if err := Setup(Options{Level: "info", Output: OutputFile}); err == nil {
+		t.Fatalf("expected error for missing file path")
+	}
+	if err := SetLevels("info", map[string]string{"archive": "chatty"}); err == nil {
+		t.Fatalf("expected error for unknown package level")
+	}
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "workmate"
+
+// maxDownloadHosts caps the distinct host label values of the download
+// metrics. Hosts come from user supplied URLs, so any host seen after the cap
+// is reported as otherHost.
+const (
+	maxDownloadHosts = 100
+	otherHost        = "other"
+)
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	downloadBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_bytes_total",
+		Help:      "Bytes downloaded from origins by host.",
+	}, []string{"host"})
+
+	downloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_duration_seconds",
+		Help:      "Time spent downloading a single URL by host and outcome.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 60},
+	}, []string{"host", "outcome"})
+
+	downloadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_failures_total",
+		Help:      "Failed downloads by host and error class.",
+	}, []string{"host", "class"})
+
+	archiveBuildDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "archive_build_duration_seconds",
+		Help:      "Time spent building an archive by outcome.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"outcome"})
+
+	archiveSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "archive_size_bytes",
+		Help:      "Size of built archives.",
+		Buckets:   prometheus.ExponentialBuckets(64<<10, 4, 10),
+	})
+
+	storeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_errors_total",
+		Help:      "Task store errors by operation.",
+	}, []string{"op"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		downloadBytes,
+		downloadDuration,
+		downloadFailures,
+		archiveBuildDuration,
+		archiveSize,
+		storeErrors,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+func ObserveHTTPRequest(route, method string, status int, latency time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpDuration.WithLabelValues(route, method, code).Observe(latency.Seconds())
+}
+
+var downloadHosts = struct {
+	sync.Mutex
+	seen map[string]struct{}
+}{seen: make(map[string]struct{})}
+
+func hostLabel(host string) string {
+	downloadHosts.Lock()
+	defer downloadHosts.Unlock()
+	if _, ok := downloadHosts.seen[host]; ok {
+		return host
+	}
+	if len(downloadHosts.seen) >= maxDownloadHosts {
+		return otherHost
+	}
+	downloadHosts.seen[host] = struct{}{}
+	return host
+}
+
+func ObserveDownload(host string, written int64, latency time.Duration, err error, statusCode int) {
+	host = hostLabel(host)
+	if written > 0 {
+		downloadBytes.WithLabelValues(host).Add(float64(written))
+	}
+	if err == nil && statusCode >= 200 && statusCode < 300 {
+		downloadDuration.WithLabelValues(host, "ok").Observe(latency.Seconds())
+		return
+	}
+	downloadDuration.WithLabelValues(host, "error").Observe(latency.Seconds())
+	downloadFailures.WithLabelValues(host, ErrorClass(err, statusCode)).Inc()
+}
+
+func ObserveArchiveBuild(latency time.Duration, sizeBytes int64, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	archiveBuildDuration.WithLabelValues(outcome).Observe(latency.Seconds())
+	if err == nil && sizeBytes >= 0 {
+		archiveSize.Observe(float64(sizeBytes))
+	}
+}
+
+func StoreError(op string) {
+	storeErrors.WithLabelValues(op).Inc()
+}
+
+func ErrorClass(err error, statusCode int) string {
+	if err == nil {
+		switch {
+		case statusCode >= 500:
+			return "http_5xx"
+		case statusCode >= 400:
+			return "http_4xx"
+		case statusCode != 0:
+			return "http_other"
+		}
+		return "none"
+	}
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &opErr):
+		return "connection"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestErrorClass(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		want   string
+	}{
+		{nil, http.StatusNotFound, "http_4xx"},
+		{nil, http.StatusBadGateway, "http_5xx"},
+		{context.Canceled, 0, "canceled"},
+		{fmt.Errorf("get: %w", context.DeadlineExceeded), 0, "timeout"},
+		{&net.DNSError{Err: "no such host", Name: "nope.invalid"}, 0, "dns"},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, 0, "connection"},
+		{errors.New("boom"), 0, "other"},
+	}
+	for _, c := range cases {
+		if got := ErrorClass(c.err, c.status); got != c.want {
+			t.Fatalf("ErrorClass(%v, %d) = %q, want %q", c.err, c.status, got, c.want)
+		}
+	}
+}
+
+type fakeTaskSource struct{}
+
+func (fakeTaskSource) CountByStatus() map[string]int { return map[string]int{"ready": 2, "failed": 1} }
+func (fakeTaskSource) SlotUsage() (int, int)         { return 3, 3 }
+func (fakeTaskSource) IsBusy() bool                  { return true }
+
+// resetMetrics lets a test register on and observe into the package
+// registry without leaking state into the next run.
+func resetMetrics(t *testing.T, collector *taskCollector) {
+	t.Cleanup(func() {
+		if collector != nil {
+			Registry.Unregister(collector)
+		}
+		httpRequests.Reset()
+		httpDuration.Reset()
+		downloadBytes.Reset()
+		downloadDuration.Reset()
+		downloadFailures.Reset()
+		downloadHosts.Lock()
+		downloadHosts.seen = make(map[string]struct{})
+		downloadHosts.Unlock()
+	})
+}
+
+func TestHandlerExposesMetrics(t *testing.T) {
+	collector := newTaskCollector(fakeTaskSource{})
+	if err := Registry.Register(collector); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	resetMetrics(t, collector)
+	ObserveHTTPRequest("/api/v1/tasks/:id", http.MethodGet, http.StatusOK, 10*time.Millisecond)
+	ObserveDownload("e.org", 42, time.Second, nil, http.StatusNotFound)
+
+	if got := testutil.ToFloat64(downloadFailures.WithLabelValues("e.org", "http_4xx")); got != 1 {
+		t.Fatalf("expected one failure, got %v", got)
+	}
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`workmate_tasks{status="ready"} 2`,
+		`workmate_worker_slots_in_use 3`,
+		`workmate_busy 1`,
+		`workmate_http_requests_total{method="GET",route="/api/v1/tasks/:id",status="200"} 1`,
+		`workmate_download_bytes_total{host="e.org"} 42`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("metrics output missing %q", want)
+		}
+	}
+}
+
+func TestDownloadHostLabelsAreCapped(t *testing.T) {
+	resetMetrics(t, nil)
+	for i := 0; i < maxDownloadHosts+5; i++ {
+		ObserveDownload(fmt.Sprintf("h%d.example", i), 1, time.Millisecond, nil, http.StatusOK)
+	}
+	if got := testutil.CollectAndCount(downloadBytes); got != maxDownloadHosts+1 {
+		t.Fatalf("expected %d host series, got %d", maxDownloadHosts+1, got)
+	}
+	if got := testutil.ToFloat64(downloadBytes.WithLabelValues(otherHost)); got != 5 {
+		t.Fatalf("expected 5 bytes folded into %q, got %v", otherHost, got)
+	}
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type TaskSource interface {
+	CountByStatus() map[string]int
+	SlotUsage() (inUse, capacity int)
+	IsBusy() bool
+}
+
+type taskCollector struct {
+	source    TaskSource
+	tasks     *prometheus.Desc
+	slotsUsed *prometheus.Desc
+	slotsCap  *prometheus.Desc
+	busy      *prometheus.Desc
+}
+
+func RegisterTaskSource(source TaskSource) error {
+	return Registry.Register(newTaskCollector(source))
+}
+
+func newTaskCollector(source TaskSource) *taskCollector {
+	return &taskCollector{
+		source:    source,
+		tasks:     prometheus.NewDesc(namespace+"_tasks", "Tasks currently known by status.", []string{"status"}, nil),
+		slotsUsed: prometheus.NewDesc(namespace+"_worker_slots_in_use", "Processing slots currently taken.", nil, nil),
+		slotsCap:  prometheus.NewDesc(namespace+"_worker_slots_capacity", "Maximum number of concurrently processed tasks.", nil, nil),
+		busy:      prometheus.NewDesc(namespace+"_busy", "1 when all processing slots are taken and new tasks are rejected.", nil, nil),
+	}
+}
+
+func (c *taskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.tasks
+	ch <- c.slotsUsed
+	ch <- c.slotsCap
+	ch <- c.busy
+}
+
+func (c *taskCollector) Collect(ch chan<- prometheus.Metric) {
+	for status, count := range c.source.CountByStatus() {
+		ch <- prometheus.MustNewConstMetric(c.tasks, prometheus.GaugeValue, float64(count), status)
+	}
+	inUse, capacity := c.source.SlotUsage()
+	ch <- prometheus.MustNewConstMetric(c.slotsUsed, prometheus.GaugeValue, float64(inUse))
+	ch <- prometheus.MustNewConstMetric(c.slotsCap, prometheus.GaugeValue, float64(capacity))
+	busy := 0.0
+	if c.source.IsBusy() {
+		busy = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.busy, prometheus.GaugeValue, busy)
+}
@@ -0,0 +1,123 @@
+package problem
+
+import (
+	"errors"
+	"net/http"
+
+	"workmate/internal/back/archive"
+	"workmate/internal/back/storage"
+	"workmate/internal/back/task"
+)
+
+const (
+	ContentType = "application/problem+json"
+	typePrefix  = "urn:workmate:problem:"
+)
+
+const (
+	CodeInvalidRequest         = "invalid_request"
+	CodeNoURLs                 = "no_urls"
+	CodeTaskNotFound           = "task_not_found"
+	CodeFileNotFound           = "file_not_found"
+	CodeTooManyFiles           = "too_many_files"
+	CodeExtensionNotAllowed    = "extension_not_allowed"
+	CodeInvalidURL             = "invalid_url"
+	CodeContentMismatch        = "content_mismatch"
+	CodeUnsupportedFormat      = "unsupported_format"
+	CodeUnsupportedCompression = "unsupported_compression"
+	CodeTitleTooLong           = "title_too_long"
+	CodeServerBusy             = "server_busy"
+	CodeInvalidState           = "invalid_state"
+	CodeArchiveNotReady        = "archive_not_ready"
+	CodeArchiveMissing         = "archive_missing"
+	CodeArchiveExpired         = "archive_expired"
+	CodeDraining               = "draining"
+	CodeUnauthorized           = "unauthorized"
+	CodeInternal               = "internal_error"
+)
+
+var (
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrUnauthorized   = errors.New("missing or invalid admin token")
+)
+
+type Problem struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	Code      string      `json:"code"`
+	Extension string      `json:"extension,omitempty"`
+	TaskID    string      `json:"task_id,omitempty"`
+	State     task.Status `json:"state,omitempty"`
+	Reason    string      `json:"reason,omitempty"`
+}
+
+type mapping struct {
+	target error
+	status int
+	code   string
+	title  string
+}
+
+var mappings = []mapping{
+	{ErrInvalidRequest, http.StatusBadRequest, CodeInvalidRequest, "Invalid request"},
+	{ErrUnauthorized, http.StatusUnauthorized, CodeUnauthorized, "Unauthorized"},
+	{task.ErrNoURLs, http.StatusBadRequest, CodeNoURLs, "No URLs provided"},
+	{task.ErrTaskNotFound, http.StatusNotFound, CodeTaskNotFound, "Task not found"},
+	{task.ErrFileNotFound, http.StatusNotFound, CodeFileNotFound, "File not found"},
+	{archive.ErrEntryNotFound, http.StatusNotFound, CodeFileNotFound, "File not found"},
+	{task.ErrTooManyFiles, http.StatusBadRequest, CodeTooManyFiles, "Too many files"},
+	{task.ErrExtNotAllowed, http.StatusBadRequest, CodeExtensionNotAllowed, "Extension not allowed"},
+	{task.ErrInvalidURL, http.StatusBadRequest, CodeInvalidURL, "Invalid URL"},
+	{task.ErrContentMismatch, http.StatusUnsupportedMediaType, CodeContentMismatch, "Content does not match extension"},
+	{task.ErrUnsupportedFormat, http.StatusBadRequest, CodeUnsupportedFormat, "Unsupported archive format"},
+	{task.ErrUnsupportedCompression, http.StatusBadRequest, CodeUnsupportedCompression, "Unsupported compression"},
+	{task.ErrTitleTooLong, http.StatusBadRequest, CodeTitleTooLong, "Title too long"},
+	{task.ErrBusy, http.StatusServiceUnavailable, CodeServerBusy, "Server busy"},
+	{task.ErrDraining, http.StatusServiceUnavailable, CodeDraining, "Server is draining"},
+	{task.ErrInvalidState, http.StatusConflict, CodeInvalidState, "Invalid task state"},
+	{task.ErrArchiveNotReady, http.StatusBadRequest, CodeArchiveNotReady, "Archive not ready"},
+	{task.ErrArchiveExpired, http.StatusGone, CodeArchiveExpired, "Archive expired"},
+	{storage.ErrNotFound, http.StatusGone, CodeArchiveMissing, "Archive missing from storage"},
+}
+
+func FromError(err error) Problem {
+	for _, m := range mappings {
+		if !errors.Is(err, m.target) {
+			continue
+		}
+		p := Problem{
+			Type:   typePrefix + m.code,
+			Title:  m.title,
+			Status: m.status,
+			Detail: err.Error(),
+			Code:   m.code,
+		}
+		var extErr *task.ExtNotAllowedError
+		if errors.As(err, &extErr) {
+			p.Extension = extErr.Ext
+		}
+		var contentErr *task.ContentMismatchError
+		if errors.As(err, &contentErr) {
+			p.Extension = contentErr.Ext
+		}
+		var stateErr *task.InvalidStateError
+		if errors.As(err, &stateErr) {
+			p.TaskID = stateErr.TaskID
+			p.State = stateErr.Status
+		}
+		var drainErr *task.DrainingError
+		if errors.As(err, &drainErr) {
+			p.Reason = drainErr.Reason
+		}
+		return p
+	}
+	return Problem{
+		Type:   typePrefix + CodeInternal,
+		Title:  "Internal server error",
+		Status: http.StatusInternalServerError,
+		Code:   CodeInternal,
+	}
+}
@@ -0,0 +1,53 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"workmate/internal/back/task"
+)
+
+func TestFromErrorMapsTaskErrors(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{task.ErrTaskNotFound, http.StatusNotFound, CodeTaskNotFound},
+		{task.ErrTooManyFiles, http.StatusBadRequest, CodeTooManyFiles},
+		{task.NewErrExtNotAllowed(".exe"), http.StatusBadRequest, CodeExtensionNotAllowed},
+		{task.ErrBusy, http.StatusServiceUnavailable, CodeServerBusy},
+		{&task.DrainingError{Reason: "maintenance"}, http.StatusServiceUnavailable, CodeDraining},
+		{ErrUnauthorized, http.StatusUnauthorized, CodeUnauthorized},
+		{task.NewErrInvalidState("t1", task.StatusReady), http.StatusConflict, CodeInvalidState},
+		{fmt.Errorf("wrapped: %w", task.ErrTaskNotFound), http.StatusNotFound, CodeTaskNotFound},
+		{errors.New("disk on fire"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, c := range cases {
+		p := FromError(c.err)
+		if p.Status != c.status || p.Code != c.code {
+			t.Fatalf("FromError(%v) = %d/%s, want %d/%s", c.err, p.Status, p.Code, c.status, c.code)
+		}
+		if p.Type != typePrefix+c.code {
+			t.Fatalf("unexpected type %q for %v", p.Type, c.err)
+		}
+	}
+}
+
+func TestFromErrorExposesFields(t *testing.T) {
+	if p := FromError(task.NewErrExtNotAllowed(".exe")); p.Extension != ".exe" {
+		t.Fatalf("expected extension field, got %+v", p)
+	}
+	p := FromError(task.NewErrInvalidState("t1", task.StatusInProgress))
+	if p.TaskID != "t1" || p.State != task.StatusInProgress {
+		t.Fatalf("expected task id and state fields, got %+v", p)
+	}
+	if p := FromError(&task.DrainingError{Reason: "maintenance"}); p.Reason != "maintenance" {
+		t.Fatalf("expected drain reason, got %+v", p)
+	}
+	if p := FromError(errors.New("secret path /var/x")); p.Detail != "" {
+		t.Fatalf("internal errors must not leak detail, got %q", p.Detail)
+	}
+}
@@ -0,0 +1,168 @@
+package reload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"workmate/internal/back/config"
+	"workmate/internal/back/logging"
+)
+
+var log = logging.Package("reload")
+
+const (
+	SourceSignal  = "sighup"
+	SourceWatcher = "watcher"
+	SourceAdmin   = "admin"
+
+	historySize = 20
+)
+
+// ApplyFunc pushes a reconciled config into the running process. live lists
+// the fields that changed; only those should be applied, so values changed at
+// runtime through other means survive an unrelated reload.
+type ApplyFunc func(cfg config.Config, live []config.Change) error
+
+type Result struct {
+	At       time.Time       `json:"at"`
+	Source   string          `json:"source"`
+	OK       bool            `json:"ok"`
+	Error    string          `json:"error,omitempty"`
+	Applied  []config.Change `json:"applied"`
+	Rejected []config.Change `json:"rejected"`
+}
+
+type Reloader struct {
+	loader config.Loader
+	apply  ApplyFunc
+
+	mu       sync.Mutex
+	current  config.Config
+	history  []Result
+	lastHash [sha256.Size]byte
+}
+
+func New(loader config.Loader, current config.Config, apply ApplyFunc) *Reloader {
+	r := &Reloader{loader: loader, current: current, apply: apply}
+	r.lastHash, _ = fileHash(loader.Path)
+	return r
+}
+
+func (r *Reloader) Current() config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+func (r *Reloader) History() []Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Result, len(r.history))
+	for i := range r.history {
+		out[i] = r.history[len(r.history)-1-i]
+	}
+	return out
+}
+
+func (r *Reloader) Reload(source string) Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := Result{At: time.Now().UTC(), Source: source}
+	r.lastHash, _ = fileHash(r.loader.Path)
+
+	next, _, err := r.loader.Load()
+	if err != nil {
+		result.Error = err.Error()
+		log.Error().Err(err).Str("source", source).Msg("config reload rejected: invalid config")
+		return r.record(result)
+	}
+
+	applied, live, rejected := config.Reconcile(r.current, next)
+	result.Applied, result.Rejected = live, rejected
+	for _, c := range rejected {
+		log.Warn().Str("field", c.Field).Str("old", c.Old).Str("new", c.New).Msg("config field cannot change at runtime, restart required")
+	}
+
+	if len(live) > 0 {
+		if err := r.apply(applied, live); err != nil {
+			result.Error = err.Error()
+			result.Applied = nil
+			log.Error().Err(err).Str("source", source).Msg("config reload failed to apply")
+			return r.record(result)
+		}
+		r.current = applied
+	}
+
+	result.OK = true
+	for _, c := range live {
+		log.Info().Str("field", c.Field).Str("old", c.Old).Str("new", c.New).Msg("config field reloaded")
+	}
+	log.Info().Str("source", source).Int("applied", len(live)).Int("rejected", len(rejected)).Msg("config reloaded")
+	return r.record(result)
+}
+
+func (r *Reloader) record(result Result) Result {
+	r.history = append(r.history, result)
+	if len(r.history) > historySize {
+		r.history = r.history[len(r.history)-historySize:]
+	}
+	return result
+}
+
+func (r *Reloader) WatchSignals(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				r.Reload(SourceSignal)
+			}
+		}
+	}()
+}
+
+func (r *Reloader) WatchFile(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if r.changedOnDisk() {
+					r.Reload(SourceWatcher)
+				}
+			}
+		}
+	}()
+}
+
+func (r *Reloader) changedOnDisk() bool {
+	sum, err := fileHash(r.loader.Path)
+	if err != nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !bytes.Equal(sum[:], r.lastHash[:])
+}
+
+func fileHash(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
@@ -0,0 +1,111 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"workmate/internal/back/config"
+)
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestReloadAppliesLiveFieldsAndRejectsOthers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "port: 8080\nmax_concurrent_tasks: 3\n")
+	initial, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	var (
+		applied  []config.Config
+		lastLive []config.Change
+	)
+	r := New(config.Loader{Path: path}, initial, func(cfg config.Config, live []config.Change) error {
+		applied = append(applied, cfg)
+		lastLive = live
+		return nil
+	})
+
+	writeConfig(t, path, "port: 9090\nmax_concurrent_tasks: 5\nallowed_extensions: [pdf]\n")
+	res := r.Reload(SourceAdmin)
+	if !res.OK || len(applied) != 1 {
+		t.Fatalf("expected successful reload, got %+v", res)
+	}
+	if len(res.Applied) != 2 || len(res.Rejected) != 1 || res.Rejected[0].Field != "port" {
+		t.Fatalf("unexpected applied/rejected: %+v", res)
+	}
+	if len(lastLive) != 2 || lastLive[0].Field != "allowed_extensions" || lastLive[1].Field != "max_concurrent_tasks" {
+		t.Fatalf("apply should get only the changed fields, got %+v", lastLive)
+	}
+	cur := r.Current()
+	if cur.Port != 8080 || cur.MaxConcurrentTasks != 5 || len(cur.AllowedExtensions) != 1 {
+		t.Fatalf("unexpected current config: %+v", cur)
+	}
+
+	writeConfig(t, path, "max_concurrent_tasks: 0\n")
+	res = r.Reload(SourceSignal)
+	if res.OK || res.Error == "" || len(applied) != 1 {
+		t.Fatalf("expected invalid config to be rejected, got %+v", res)
+	}
+	if r.Current().MaxConcurrentTasks != 5 {
+		t.Fatalf("invalid reload must not change current config")
+	}
+
+	history := r.History()
+	if len(history) != 2 || history[0].Source != SourceSignal {
+		t.Fatalf("expected newest-first history, got %+v", history)
+	}
+}
+
+func TestReloadKeepsConfigWhenApplyFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "max_concurrent_tasks: 3\n")
+	initial, _ := config.Load(path)
+	r := New(config.Loader{Path: path}, initial, func(config.Config, []config.Change) error { return errors.New("nope") })
+
+	writeConfig(t, path, "max_concurrent_tasks: 4\n")
+	if res := r.Reload(SourceAdmin); res.OK || res.Error != "nope" {
+		t.Fatalf("expected apply error, got %+v", res)
+	}
+	if r.Current().MaxConcurrentTasks != 3 {
+		t.Fatalf("failed apply must not change current config")
+	}
+}
+
+func TestWatchFileReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "max_concurrent_tasks: 3\n")
+	initial, _ := config.Load(path)
+	reloaded := make(chan config.Config, 1)
+	r := New(config.Loader{Path: path}, initial, func(cfg config.Config, _ []config.Change) error {
+		reloaded <- cfg
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.WatchFile(ctx, 10*time.Millisecond)
+
+	writeConfig(t, path, "max_concurrent_tasks: 7\n")
+	select {
+	case cfg := <-reloaded:
+		if cfg.MaxConcurrentTasks != 7 {
+			t.Fatalf("unexpected reloaded config: %+v", cfg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("watcher did not pick up the change")
+	}
+	if h := r.History(); len(h) != 1 || h[0].Source != SourceWatcher {
+		t.Fatalf("expected one watcher reload, got %+v", h)
+	}
+}
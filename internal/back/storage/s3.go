@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const archiveContentType = "application/zip"
+
+type S3Options struct {
+	// Endpoint is host[:port] without a scheme, e.g. s3.amazonaws.com or
+	// localhost:9000 for MinIO.
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+	// Prefix is prepended to every key, e.g. "workmate/".
+	Prefix string
+}
+
+// S3 stores archives in an S3-compatible bucket.
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(opts S3Options) (*S3, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKeyID, opts.SecretAccessKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3 client: %w", err)
+	}
+	return &S3{client: client, bucket: opts.Bucket, prefix: opts.Prefix}, nil
+}
+
+func (s *S3) objectName(key string) string {
+	return path.Join(s.prefix, "archives", key+".zip")
+}
+
+func (s *S3) Put(ctx context.Context, key, localPath string) error {
+	name := s.objectName(key)
+	info, err := s.client.FPutObject(ctx, s.bucket, name, localPath, minio.PutObjectOptions{ContentType: archiveContentType})
+	if err != nil {
+		return fmt.Errorf("upload %s: %w", name, err)
+	}
+	log.Ctx(ctx).Info().Str("bucket", s.bucket).Str("object", name).Int64("size", info.Size).Msg("archive uploaded")
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (*Object, error) {
+	name := s.objectName(key)
+	obj, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.mapError(name, err)
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		_ = obj.Close()
+		return nil, s.mapError(name, err)
+	}
+	return &Object{ReadSeekCloser: obj, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+func (s *S3) PresignGet(ctx context.Context, key, filename string, ttl time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	params.Set("response-content-type", archiveContentType)
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, s.objectName(key), ttl, params)
+	if err != nil {
+		return "", fmt.Errorf("presign %s: %w", key, err)
+	}
+	return u.String(), nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	name := s.objectName(key)
+	if err := s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{}); err != nil {
+		if err := s.mapError(name, err); !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3) Driver() string { return DriverS3 }
+
+func (s *S3) mapError(name string, err error) error {
+	resp := minio.ToErrorResponse(err)
+	if resp.StatusCode == http.StatusNotFound || strings.HasPrefix(resp.Code, "NoSuch") {
+		return fmt.Errorf("%w: %s/%s", ErrNotFound, s.bucket, name)
+	}
+	return fmt.Errorf("s3 %s/%s: %w", s.bucket, name, err)
+}
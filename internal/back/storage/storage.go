@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"workmate/internal/back/logging"
+)
+
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+var (
+	ErrNotFound           = errors.New("archive object not found")
+	ErrPresignUnsupported = errors.New("storage does not support presigned urls")
+)
+
+var log = logging.Package("storage")
+
+// Object is an opened archive. The reader is seekable so handlers can serve
+// range requests from it.
+type Object struct {
+	io.ReadSeekCloser
+	Size    int64
+	ModTime time.Time
+}
+
+// ArchiveStorage keeps finished archives under a key, one object per task.
+type ArchiveStorage interface {
+	// Put publishes the archive built at localPath under key.
+	Put(ctx context.Context, key, localPath string) error
+	Open(ctx context.Context, key string) (*Object, error)
+	// PresignGet returns a time-limited download url that makes the client
+	// save the object as filename.
+	PresignGet(ctx context.Context, key, filename string, ttl time.Duration) (string, error)
+	Delete(ctx context.Context, key string) error
+	Driver() string
+}
+
+// Local keeps archives on the local disk at the path returned by pathFor,
+// normally TaskStore.ArchivePath, so archives built in place need no copy.
+type Local struct {
+	pathFor func(key string) string
+}
+
+func NewLocal(pathFor func(key string) string) *Local {
+	return &Local{pathFor: pathFor}
+}
+
+func (l *Local) Put(_ context.Context, key, localPath string) error {
+	target := l.pathFor(key)
+	if filepath.Clean(target) == filepath.Clean(localPath) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(localPath, target)
+}
+
+func (l *Local) Open(_ context.Context, key string) (*Object, error) {
+	f, err := os.Open(l.pathFor(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &Object{ReadSeekCloser: f, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (l *Local) PresignGet(context.Context, string, string, time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	if err := os.Remove(l.pathFor(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Driver() string { return DriverLocal }
+
+// Fetch copies the object under key to localPath through a temp file in the
+// same directory, so a reader never sees a partial archive.
+func Fetch(ctx context.Context, s ArchiveStorage, key, localPath string) error {
+	obj, err := s.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = obj.Close() }()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), ".tmp-fetch-*")
+	if err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(tmp, obj)
+	closeErr := tmp.Close()
+	if err := errors.Join(copyErr, closeErr); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("fetch %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	log.Debug().Str("key", key).Str("driver", s.Driver()).Msg("archive fetched to local cache")
+	return nil
+}
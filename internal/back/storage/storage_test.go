@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a path-style, in-memory bucket that speaks just enough of the S3
+// protocol for PUT, GET, HEAD and DELETE of single objects.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		body, err := readS3Body(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[name] = body
+		sum := md5.Sum(body)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case http.MethodGet, http.MethodHead:
+		body, ok := f.objects[name]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				_, _ = io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			}
+			return
+		}
+		sum := md5.Sum(body)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		http.ServeContent(w, r, name, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), bytes.NewReader(body))
+	case http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// readS3Body decodes aws-chunked uploads, which the client uses over plain
+// http.
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var out bytes.Buffer
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return out.Bytes(), nil
+		}
+		if _, err := io.CopyN(&out, br, size); err != nil {
+			return nil, err
+		}
+		if _, err := br.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func newFakeS3(t *testing.T) (*S3, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	s, err := NewS3(S3Options{Endpoint: u.Host, Bucket: "bucket", Region: "us-east-1", AccessKeyID: "key", SecretAccessKey: "secret", Prefix: "wm"})
+	if err != nil {
+		t.Fatalf("new s3: %v", err)
+	}
+	return s, fake
+}
+
+func TestS3PutOpenPresignDelete(t *testing.T) {
+	ctx := context.Background()
+	s, fake := newFakeS3(t)
+
+	local := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(local, []byte("zip bytes"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := s.Put(ctx, "task1", local); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if got := string(fake.objects["bucket/wm/archives/task1.zip"]); got != "zip bytes" {
+		t.Fatalf("unexpected stored object %q (%v)", got, fake.objects)
+	}
+
+	obj, err := s.Open(ctx, "task1")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if obj.Size != 9 {
+		t.Fatalf("expected size 9, got %d", obj.Size)
+	}
+	if _, err := obj.Seek(4, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	rest, _ := io.ReadAll(obj)
+	_ = obj.Close()
+	if string(rest) != "bytes" {
+		t.Fatalf("expected ranged read, got %q", rest)
+	}
+
+	cached := filepath.Join(t.TempDir(), "cache", "archive.zip")
+	if err := Fetch(ctx, s, "task1", cached); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if body, _ := os.ReadFile(cached); string(body) != "zip bytes" {
+		t.Fatalf("fetched %q", body)
+	}
+
+	signed, err := s.PresignGet(ctx, "task1", "archive-task1.zip", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("presign: %v", err)
+	}
+	pu, _ := url.Parse(signed)
+	q := pu.Query()
+	if pu.Path != "/bucket/wm/archives/task1.zip" || q.Get("X-Amz-Expires") != "300" || q.Get("X-Amz-Signature") == "" {
+		t.Fatalf("unexpected presigned url %s", signed)
+	}
+	if !strings.Contains(q.Get("response-content-disposition"), "archive-task1.zip") {
+		t.Fatalf("presigned url misses content disposition: %s", signed)
+	}
+
+	if err := s.Delete(ctx, "task1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Open(ctx, "task1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := NewLocal(func(key string) string { return filepath.Join(dir, key, "archive.zip") })
+
+	built := filepath.Join(dir, "build.zip")
+	if err := os.WriteFile(built, []byte("zip"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := s.Put(ctx, "t1", built); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	obj, err := s.Open(ctx, "t1")
+	if err != nil || obj.Size != 3 {
+		t.Fatalf("open: %+v, %v", obj, err)
+	}
+	_ = obj.Close()
+	if _, err := s.PresignGet(ctx, "t1", "a.zip", time.Minute); !errors.Is(err, ErrPresignUnsupported) {
+		t.Fatalf("expected ErrPresignUnsupported, got %v", err)
+	}
+	if err := s.Delete(ctx, "t1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Open(ctx, "t1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
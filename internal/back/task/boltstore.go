@@ -0,0 +1,405 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	fileutil "workmate/internal/back/file"
+	"workmate/internal/back/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	bucketTasks      = []byte("tasks")
+	bucketByStatus   = []byte("tasks_by_status")
+	bucketByCreated  = []byte("tasks_by_created")
+	bucketMeta       = []byte("meta")
+	metaFileMigrated = []byte("file_store_migrated_at")
+)
+
+const boltOpenTimeout = time.Second
+
+// boltStore keeps task records in a single bbolt file. Every record change
+// rewrites the secondary indexes in the same transaction, so lookups by
+// status or creation time never observe a half-applied update. Archives and
+// uploads stay in the per-task directories used by the file store.
+type boltStore struct {
+	files *fileStore
+	db    *bolt.DB
+}
+
+func openBoltStore(dataDir, path string, readOnly bool) (*boltStore, error) {
+	files := &fileStore{dataDir: dataDir, readOnly: readOnly}
+	if readOnly {
+		// bbolt still takes a shared flock, which waits for a server that
+		// holds the database open for writing.
+		db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout, ReadOnly: true})
+		if errors.Is(err, bolt.ErrTimeout) {
+			return nil, fmt.Errorf("%w: %s is open for writing", ErrDataDirInUse, path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", path, err)
+		}
+		return &boltStore{files: files, db: db}, nil
+	}
+	if err := fileutil.EnsureDir(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("ensure store dir: %w", err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketTasks, bucketByStatus, bucketByCreated, bucketMeta} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("init buckets: %w", err)
+	}
+	return &boltStore{files: files, db: db}, nil
+}
+
+func (s *boltStore) ArchivePath(taskID string) string {
+	return s.files.ArchivePath(taskID)
+}
+
+func (s *boltStore) EnsureTaskDir(ctx context.Context, taskID string) (string, error) {
+	return s.files.EnsureTaskDir(ctx, taskID)
+}
+
+func (s *boltStore) SaveTask(ctx context.Context, t *Task) (err error) {
+	_, span := tracing.Tracer().Start(ctx, "store.save_task", trace.WithAttributes(
+		attribute.String("task.id", t.ID),
+		attribute.String("task.status", string(t.Status)),
+		attribute.String("store.driver", StoreDriverBolt),
+	))
+	defer func() { endSpan(span, err) }()
+
+	record, err := json.Marshal(versionedRecord(t))
+	if err != nil {
+		return fmt.Errorf("encode task: %w", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putTask(tx, t.ID, record, t)
+	})
+}
+
+func putTask(tx *bolt.Tx, id string, record []byte, t *Task) error {
+	tasks := tx.Bucket(bucketTasks)
+	if previous := tasks.Get([]byte(id)); previous != nil {
+		var old Task
+		if err := json.Unmarshal(previous, &old); err == nil {
+			if err := tx.Bucket(bucketByStatus).Delete(statusKey(old.Status, id)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(bucketByCreated).Delete(createdKey(old.CreatedAt, id)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tasks.Put([]byte(id), record); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketByStatus).Put(statusKey(t.Status, id), nil); err != nil {
+		return err
+	}
+	return tx.Bucket(bucketByCreated).Put(createdKey(t.CreatedAt, id), nil)
+}
+
+// LoadTasks decodes every record and rewrites the ones upgraded to the
+// current schema version in a single transaction.
+func (s *boltStore) LoadTasks(ctx context.Context) (_ []*Task, report LoadReport, err error) {
+	_, span := tracing.Tracer().Start(ctx, "store.load_tasks", trace.WithAttributes(attribute.String("store.driver", StoreDriverBolt)))
+	defer func() { endSpan(span, err) }()
+
+	var (
+		tasks    []*Task
+		migrated []*Task
+	)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTasks).ForEach(func(k, v []byte) error {
+			t, upgraded, err := decodeRecord(v)
+			if err != nil {
+				report.fail(string(k), "", err)
+				return nil
+			}
+			if upgraded {
+				migrated = append(migrated, t)
+			}
+			tasks = append(tasks, t)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, report, err
+	}
+	if len(migrated) > 0 && !s.db.IsReadOnly() {
+		err = s.db.Update(func(tx *bolt.Tx) error {
+			for _, t := range migrated {
+				record, err := json.Marshal(versionedRecord(t))
+				if err != nil {
+					return fmt.Errorf("encode task %s: %w", t.ID, err)
+				}
+				if err := putTask(tx, t.ID, record, t); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, report, fmt.Errorf("rewrite migrated records: %w", err)
+		}
+		for _, t := range migrated {
+			t.SchemaVersion = CurrentSchemaVersion
+			report.Migrated = append(report.Migrated, t.ID)
+		}
+	}
+	report.Loaded = len(tasks)
+	span.SetAttributes(
+		attribute.Int("store.tasks_loaded", len(tasks)),
+		attribute.Int("store.tasks_migrated", len(report.Migrated)),
+		attribute.Int("store.tasks_failed", len(report.Failed)),
+	)
+	return tasks, report, nil
+}
+
+func (s *boltStore) LoadTask(ctx context.Context, taskID string) (*Task, error) {
+	var raw []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketTasks).Get([]byte(taskID)); v != nil {
+			raw = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrTaskNotFound
+	}
+	t, _, err := decodeRecord(raw)
+	return t, err
+}
+
+func (s *boltStore) QueryTasks(ctx context.Context, q Query) (_ []*Task, err error) {
+	_, span := tracing.Tracer().Start(ctx, "store.query_tasks", trace.WithAttributes(attribute.String("store.driver", StoreDriverBolt)))
+	defer func() { endSpan(span, err) }()
+
+	var tasks []*Task
+	err = s.db.View(func(tx *bolt.Tx) error {
+		records := tx.Bucket(bucketTasks)
+		load := func(id []byte) (*Task, error) {
+			raw := records.Get(id)
+			if raw == nil {
+				return nil, nil
+			}
+			t, _, err := decodeRecord(raw)
+			if err != nil {
+				return nil, fmt.Errorf("decode task %s: %w", id, err)
+			}
+			return t, nil
+		}
+
+		if q.Status != "" {
+			prefix := statusKey(q.Status, "")
+			c := tx.Bucket(bucketByStatus).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				t, err := load(k[len(prefix):])
+				if err != nil {
+					return err
+				}
+				if t != nil && q.matchTime(t) {
+					tasks = append(tasks, t)
+				}
+			}
+			sortByCreated(tasks)
+			return nil
+		}
+
+		c := tx.Bucket(bucketByCreated).Cursor()
+		k, _ := c.First()
+		if !q.Since.IsZero() {
+			k, _ = c.Seek(createdKey(q.Since, ""))
+		}
+		for ; k != nil; k, _ = c.Next() {
+			if !q.Until.IsZero() && bytes.Compare(k, createdKey(q.Until, "")) >= 0 {
+				break
+			}
+			if q.Limit > 0 && len(tasks) == q.Limit {
+				break
+			}
+			t, err := load(k[8:])
+			if err != nil {
+				return err
+			}
+			if t != nil {
+				tasks = append(tasks, t)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 && len(tasks) > q.Limit {
+		tasks = tasks[:q.Limit]
+	}
+	return tasks, nil
+}
+
+func (s *boltStore) DeleteTask(ctx context.Context, taskID string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		id := []byte(taskID)
+		var old Task
+		if raw := tx.Bucket(bucketTasks).Get(id); raw == nil || json.Unmarshal(raw, &old) != nil {
+			if err := deleteIndexEntries(tx, taskID); err != nil {
+				return err
+			}
+		} else {
+			if err := tx.Bucket(bucketByStatus).Delete(statusKey(old.Status, taskID)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(bucketByCreated).Delete(createdKey(old.CreatedAt, taskID)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(bucketTasks).Delete(id)
+	})
+	if err != nil {
+		return err
+	}
+	return s.files.DeleteTask(ctx, taskID)
+}
+
+// Quarantine copies the raw record next to the moved task directory and
+// removes it, with its index entries, from the database.
+func (s *boltStore) Quarantine(ctx context.Context, failed RecordError) (QuarantinedRecord, error) {
+	target, err := quarantineTarget(s.files.dataDir, failed.TaskID)
+	if err != nil {
+		return QuarantinedRecord{}, err
+	}
+	id := []byte(failed.TaskID)
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if raw := tx.Bucket(bucketTasks).Get(id); raw != nil {
+			if err := os.WriteFile(filepath.Join(target, recordFile), raw, 0o644); err != nil {
+				return fmt.Errorf("copy record: %w", err)
+			}
+		}
+		if err := tx.Bucket(bucketTasks).Delete(id); err != nil {
+			return err
+		}
+		return deleteIndexEntries(tx, failed.TaskID)
+	})
+	if err != nil {
+		return QuarantinedRecord{}, err
+	}
+	failed.Path = "bolt:" + failed.TaskID
+	return writeReason(target, failed)
+}
+
+// deleteIndexEntries removes every index key that points at id. It scans
+// the indexes because the record itself may no longer be decodable.
+func deleteIndexEntries(tx *bolt.Tx, id string) error {
+	for _, name := range [][]byte{bucketByStatus, bucketByCreated} {
+		var stale [][]byte
+		c := tx.Bucket(name).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			if indexPointsAt(name, k, id) {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+		}
+		for _, k := range stale {
+			if err := tx.Bucket(name).Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func indexPointsAt(bucket, key []byte, id string) bool {
+	if bytes.Equal(bucket, bucketByCreated) {
+		return len(key) == 8+len(id) && string(key[8:]) == id
+	}
+	return bytes.HasSuffix(key, []byte("\x00"+id))
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// migrateFromFiles imports every status.json found under dataDir the first
+// time the database is opened. The JSON files are left in place so switching
+// back to the file driver keeps working.
+func (s *boltStore) migrateFromFiles(ctx context.Context) (int, error) {
+	var done bool
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		done = tx.Bucket(bucketMeta).Get(metaFileMigrated) != nil
+		return nil
+	})
+	if done {
+		return 0, nil
+	}
+
+	legacy, _, err := s.files.LoadTasks(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("read file store: %w", err)
+	}
+	imported := 0
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		for _, t := range legacy {
+			if tx.Bucket(bucketTasks).Get([]byte(t.ID)) != nil {
+				continue
+			}
+			record, err := json.Marshal(versionedRecord(t))
+			if err != nil {
+				return fmt.Errorf("encode task %s: %w", t.ID, err)
+			}
+			if err := putTask(tx, t.ID, record, t); err != nil {
+				return err
+			}
+			imported++
+		}
+		return tx.Bucket(bucketMeta).Put(metaFileMigrated, []byte(time.Now().UTC().Format(time.RFC3339)))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
+
+func statusKey(status Status, id string) []byte {
+	return []byte(string(status) + "\x00" + id)
+}
+
+func createdKey(at time.Time, id string) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(at.UnixNano()))
+	return append(key, id...)
+}
+
+func sortByCreated(tasks []*Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].CreatedAt.Equal(tasks[j].CreatedAt) {
+			return tasks[i].ID < tasks[j].ID
+		}
+		return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
+	})
+}
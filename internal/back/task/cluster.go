@@ -0,0 +1,553 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	fileutil "workmate/internal/back/file"
+)
+
+const (
+	defaultLeaseTTL = 30 * time.Second
+	clusterDirName  = "cluster"
+	// clusterPollInterval is how often a task waiting for room under the
+	// cluster-wide limit checks again.
+	clusterPollInterval = 250 * time.Millisecond
+)
+
+var (
+	ErrLeaseHeld   = errors.New("task is claimed by another instance")
+	errClusterBusy = errors.New("cluster concurrency limit reached")
+)
+
+type ClusterOptions struct {
+	// Enabled coordinates this process with other instances sharing DataDir
+	// through lock and lease files under DataDir/cluster.
+	Enabled bool
+	// InstanceID names this process in leases; defaults to hostname-pid.
+	InstanceID string
+	// LeaseTTL is how long a claim survives without a heartbeat before
+	// another instance may take the task over.
+	LeaseTTL time.Duration
+	// MaxConcurrentTasks caps the tasks in progress across all instances;
+	// 0 leaves only the per-instance limit.
+	MaxConcurrentTasks int
+	// CacheTTL is how long a cached task is trusted before GetTask reads the
+	// record again; 0 rereads on every call.
+	CacheTTL time.Duration
+}
+
+// lease is the claim of one instance on a task, kept in
+// DataDir/cluster/leases/<id>.json. A queued task holds a lease too, so the
+// queue of an instance that dies is taken over with its running tasks.
+type lease struct {
+	TaskID    string    `json:"task_id"`
+	Instance  string    `json:"instance"`
+	Running   bool      `json:"running"`
+	ClaimedAt time.Time `json:"claimed_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (l *lease) live(now time.Time) bool {
+	return l != nil && now.Before(l.ExpiresAt)
+}
+
+type heldLease struct {
+	// cancel stops the worker when the lease turns out to be lost.
+	cancel context.CancelFunc
+}
+
+type cluster struct {
+	opts ClusterOptions
+	dir  string
+
+	mu      sync.Mutex
+	held    map[string]*heldLease
+	fetched map[string]time.Time
+}
+
+func newCluster(dataDir string, opts ClusterOptions) *cluster {
+	if opts.InstanceID == "" {
+		host, _ := os.Hostname()
+		opts.InstanceID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if opts.LeaseTTL <= 0 {
+		opts.LeaseTTL = defaultLeaseTTL
+	}
+	return &cluster{
+		opts:    opts,
+		dir:     filepath.Join(dataDir, clusterDirName),
+		held:    make(map[string]*heldLease),
+		fetched: make(map[string]time.Time),
+	}
+}
+
+func (c *cluster) leasePath(taskID string) string {
+	return filepath.Join(c.dir, "leases", filepath.Base(taskID)+".json")
+}
+
+func (c *cluster) lockPath(taskID string) string {
+	return filepath.Join(c.dir, "locks", filepath.Base(taskID)+".lock")
+}
+
+// RemoveClusterFiles deletes the lease and lock files of a task that was
+// deleted from the store. Only call it while no instance is running, e.g.
+// under the exclusive data dir lock: a lock file removed while held would let
+// two instances lock different files.
+func RemoveClusterFiles(dataDir, taskID string) error {
+	c := &cluster{dir: filepath.Join(dataDir, clusterDirName)}
+	var errs []error
+	for _, path := range []string{c.leasePath(taskID), c.lockPath(taskID)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// withClusterLock serializes lease changes across instances; the global
+// concurrency limit is only meaningful while it is held.
+func (c *cluster) withClusterLock(fn func() error) error {
+	l, err := fileutil.Lock(filepath.Join(c.dir, "cluster.lock"))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = l.Unlock() }()
+	return fn()
+}
+
+func (c *cluster) readLease(taskID string) (*lease, error) {
+	raw, err := os.ReadFile(c.leasePath(taskID))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read lease: %w", err)
+	}
+	var l lease
+	if err := json.Unmarshal(raw, &l); err != nil {
+		return nil, fmt.Errorf("decode lease %s: %w", taskID, err)
+	}
+	return &l, nil
+}
+
+func (c *cluster) writeLease(l *lease) error {
+	l.ExpiresAt = time.Now().Add(c.opts.LeaseTTL).UTC()
+	return fileutil.WriteJSONAtomic(c.leasePath(l.TaskID), l)
+}
+
+func (c *cluster) removeLease(taskID string) error {
+	if err := os.Remove(c.leasePath(taskID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove lease: %w", err)
+	}
+	return nil
+}
+
+func (c *cluster) leases() ([]*lease, error) {
+	entries, err := os.ReadDir(filepath.Join(c.dir, "leases"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read leases: %w", err)
+	}
+	out := make([]*lease, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".tmp-") {
+			continue
+		}
+		l, err := c.readLease(strings.TrimSuffix(name, ".json"))
+		if err != nil || l == nil {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+// claim takes the lease of a task that has none, whose lease expired or
+// that this instance already holds.
+func (c *cluster) claim(taskID string) error {
+	return c.withClusterLock(func() error {
+		current, err := c.readLease(taskID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if current.live(now) && current.Instance != c.opts.InstanceID {
+			return fmt.Errorf("%w: %s", ErrLeaseHeld, current.Instance)
+		}
+		if current != nil && current.Instance != c.opts.InstanceID {
+			log.Warn().Str("task_id", taskID).Str("previous_instance", current.Instance).
+				Time("expired_at", current.ExpiresAt).Msg("taking over task with expired lease")
+		}
+		if err := c.writeLease(&lease{TaskID: taskID, Instance: c.opts.InstanceID, ClaimedAt: now.UTC()}); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.held[taskID] = &heldLease{}
+		c.mu.Unlock()
+		return nil
+	})
+}
+
+// start marks a claimed task as running, returning errClusterBusy while the
+// cluster-wide limit is reached.
+func (c *cluster) start(taskID string, cancel context.CancelFunc) error {
+	return c.withClusterLock(func() error {
+		current, err := c.readLease(taskID)
+		if err != nil {
+			return err
+		}
+		if current == nil || current.Instance != c.opts.InstanceID {
+			c.forget(taskID)
+			return ErrLeaseHeld
+		}
+		if limit := c.opts.MaxConcurrentTasks; limit > 0 {
+			all, err := c.leases()
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			running := 0
+			for _, l := range all {
+				if l.Running && l.live(now) && l.TaskID != taskID {
+					running++
+				}
+			}
+			if running >= limit {
+				return errClusterBusy
+			}
+		}
+		current.Running = true
+		if err := c.writeLease(current); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.held[taskID] = &heldLease{cancel: cancel}
+		c.mu.Unlock()
+		return nil
+	})
+}
+
+func (c *cluster) release(taskID string) {
+	err := c.withClusterLock(func() error {
+		current, err := c.readLease(taskID)
+		if err != nil || current == nil || current.Instance != c.opts.InstanceID {
+			return err
+		}
+		return c.removeLease(taskID)
+	})
+	c.forget(taskID)
+	if err != nil {
+		log.Warn().Str("task_id", taskID).Err(err).Msg("release lease failed")
+	}
+}
+
+func (c *cluster) forget(taskID string) {
+	c.mu.Lock()
+	delete(c.held, taskID)
+	c.mu.Unlock()
+}
+
+// heartbeat extends every lease this instance holds. A lease another
+// instance took over in the meantime is dropped and its worker cancelled.
+func (c *cluster) heartbeat() {
+	c.mu.Lock()
+	held := make(map[string]*heldLease, len(c.held))
+	for id, h := range c.held {
+		held[id] = h
+	}
+	c.mu.Unlock()
+
+	for taskID, h := range held {
+		err := c.withClusterLock(func() error {
+			current, err := c.readLease(taskID)
+			if err != nil {
+				return err
+			}
+			if current == nil || current.Instance != c.opts.InstanceID {
+				return ErrLeaseHeld
+			}
+			return c.writeLease(current)
+		})
+		switch {
+		case errors.Is(err, ErrLeaseHeld):
+			log.Warn().Str("task_id", taskID).Msg("lease lost to another instance")
+			c.forget(taskID)
+			if h.cancel != nil {
+				h.cancel()
+			}
+		case err != nil:
+			log.Warn().Str("task_id", taskID).Err(err).Msg("renew lease failed")
+		}
+	}
+}
+
+func (c *cluster) holds(taskID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.held[taskID]
+	return ok
+}
+
+func (c *cluster) stale(taskID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	at, ok := c.fetched[taskID]
+	return !ok || time.Since(at) >= c.opts.CacheTTL
+}
+
+func (c *cluster) markFetched(taskID string) {
+	c.mu.Lock()
+	c.fetched[taskID] = time.Now()
+	c.mu.Unlock()
+}
+
+func (c *cluster) dropFetched(taskID string) {
+	c.mu.Lock()
+	delete(c.fetched, taskID)
+	c.mu.Unlock()
+}
+
+// InstanceID returns the name this process uses in cluster leases, or ""
+// when clustering is off.
+func (m *Manager) InstanceID() string {
+	if m.cluster == nil {
+		return ""
+	}
+	return m.cluster.opts.InstanceID
+}
+
+// syncTask rereads a task another instance may have changed once the cached
+// copy is older than CacheTTL. Tasks this instance is processing are
+// authoritative in memory and are not reread.
+func (m *Manager) syncTask(ctx context.Context, taskID string) {
+	if m.cluster == nil || !m.cluster.stale(taskID) || m.processingLocally(taskID) {
+		return
+	}
+	m.reloadTask(ctx, taskID)
+}
+
+func (m *Manager) processingLocally(taskID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, processing := m.workers[taskID]
+	return processing
+}
+
+// reloadTask replaces the cached task with the stored record. The record is
+// stored as a new pointer: readers get copies from GetTask, and code that
+// changes a task looks it up again after reloading.
+func (m *Manager) reloadTask(ctx context.Context, taskID string) {
+	fresh, err := m.store.LoadTask(ctx, taskID)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		m.mu.Lock()
+		delete(m.tasks, taskID)
+		m.mu.Unlock()
+		m.cluster.dropFetched(taskID)
+		return
+	case err != nil:
+		// A record being rewritten by another instance may be briefly
+		// unreadable; keep the cached copy until the next read.
+		log.Ctx(ctx).Debug().Str("task_id", taskID).Err(err).Msg("reload task failed")
+		return
+	}
+	m.mu.Lock()
+	m.tasks[taskID] = fresh
+	m.mu.Unlock()
+	m.cluster.markFetched(taskID)
+}
+
+// lockTask serializes changes to a task across instances and refreshes the
+// cached copy once the lock is held, unless this instance is processing it.
+// The returned func releases the lock.
+func (m *Manager) lockTask(ctx context.Context, taskID string) (func(), error) {
+	if m.cluster == nil {
+		return func() {}, nil
+	}
+	l, err := fileutil.Lock(m.cluster.lockPath(taskID))
+	if err != nil {
+		return nil, fmt.Errorf("lock task: %w", err)
+	}
+	if !m.processingLocally(taskID) {
+		m.reloadTask(ctx, taskID)
+	}
+	return func() { _ = l.Unlock() }, nil
+}
+
+// claimTask takes the cluster lease before a task is queued so only one
+// instance processes it.
+func (m *Manager) claimTask(ctx context.Context, taskID string) bool {
+	if m.cluster == nil {
+		return true
+	}
+	if err := m.cluster.claim(taskID); err != nil {
+		event := log.Ctx(ctx).Warn()
+		if errors.Is(err, ErrLeaseHeld) {
+			event = log.Ctx(ctx).Info()
+		}
+		event.Str("task_id", taskID).Err(err).Msg("task not queued on this instance")
+		return false
+	}
+	return true
+}
+
+// beginClusterWork waits for room under the cluster-wide limit and then
+// checks that the stored task still needs processing: another instance may
+// have finished it while this one had it queued. On false the lease is
+// already released.
+func (m *Manager) beginClusterWork(ctx context.Context, taskID string, cancel context.CancelFunc) bool {
+	if m.cluster == nil {
+		return true
+	}
+	for {
+		err := m.cluster.start(taskID, cancel)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errClusterBusy) {
+			log.Ctx(ctx).Warn().Str("task_id", taskID).Err(err).Msg("cluster claim failed")
+			if !errors.Is(err, ErrLeaseHeld) {
+				m.cluster.release(taskID)
+			}
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			m.cluster.release(taskID)
+			return false
+		case <-time.After(clusterPollInterval):
+		}
+	}
+	m.reloadTask(ctx, taskID)
+	m.mu.RLock()
+	t, ok := m.tasks[taskID]
+	runnable := ok && needsProcessing(t)
+	m.mu.RUnlock()
+	if !runnable {
+		m.cluster.release(taskID)
+	}
+	return runnable
+}
+
+// leaseLost reports whether another instance took the task over while this
+// one was building it; the late result must not overwrite theirs.
+func (m *Manager) leaseLost(ctx context.Context, taskID string) bool {
+	if m.cluster == nil {
+		return false
+	}
+	current, err := m.cluster.readLease(taskID)
+	if err != nil {
+		log.Ctx(ctx).Warn().Str("task_id", taskID).Err(err).Msg("check lease failed")
+		return false
+	}
+	if current != nil && current.Instance == m.cluster.opts.InstanceID {
+		return false
+	}
+	log.Ctx(ctx).Warn().Str("task_id", taskID).Msg("lease lost while processing, result discarded")
+	return true
+}
+
+func (m *Manager) endClusterWork(taskID string) {
+	if m.cluster != nil {
+		m.cluster.release(taskID)
+	}
+}
+
+func needsProcessing(t *Task) bool {
+	return t.Status == StatusInProgress || (t.Status == StatusCreated && len(t.Files) == MaxFilesPerTask)
+}
+
+// RunCluster renews this instance's leases and takes over the tasks of
+// instances whose leases expired, until ctx ends. It also picks up tasks
+// left in progress or queued without any lease, e.g. by a crash before
+// clustering was enabled.
+func (m *Manager) RunCluster(ctx context.Context) {
+	if m.cluster == nil {
+		return
+	}
+	interval := m.cluster.opts.LeaseTTL / 3
+	go func() {
+		m.takeOverOrphans(ctx)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.cluster.heartbeat()
+				m.takeOverOrphans(ctx)
+			}
+		}
+	}()
+}
+
+func (m *Manager) takeOverOrphans(ctx context.Context) {
+	if draining, _ := m.DrainState(); draining {
+		return
+	}
+	leases, err := m.cluster.leases()
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("scan leases failed")
+		return
+	}
+	now := time.Now()
+	leased := make(map[string]bool, len(leases))
+	var candidates []string
+	for _, l := range leases {
+		leased[l.TaskID] = true
+		if !l.live(now) && !m.cluster.holds(l.TaskID) {
+			candidates = append(candidates, l.TaskID)
+		}
+	}
+	m.mu.RLock()
+	for id, t := range m.tasks {
+		if !leased[id] && needsProcessing(t) {
+			candidates = append(candidates, id)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, taskID := range candidates {
+		if m.cluster.holds(taskID) {
+			continue
+		}
+		m.reloadTask(ctx, taskID)
+		m.mu.RLock()
+		t, ok := m.tasks[taskID]
+		runnable := ok && needsProcessing(t)
+		m.mu.RUnlock()
+		if !runnable {
+			m.dropStaleLease(taskID)
+			continue
+		}
+		m.launchProcessing(ctx, taskID)
+	}
+}
+
+// dropStaleLease removes an expired lease left behind for a task that no
+// longer needs processing.
+func (m *Manager) dropStaleLease(taskID string) {
+	err := m.cluster.withClusterLock(func() error {
+		current, err := m.cluster.readLease(taskID)
+		if err != nil || current == nil || current.live(time.Now()) {
+			return err
+		}
+		return m.cluster.removeLease(taskID)
+	})
+	if err != nil {
+		log.Warn().Str("task_id", taskID).Err(err).Msg("remove stale lease failed")
+	}
+}
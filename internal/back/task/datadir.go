@@ -0,0 +1,33 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	fileutil "workmate/internal/back/file"
+)
+
+const dataDirLockFile = "workmate.lock"
+
+var (
+	ErrDataDirInUse   = errors.New("data dir is in use")
+	ErrJournalPending = errors.New("journal has uncompacted events")
+)
+
+// LockDataDir takes the lock on dataDir. A server holds it shared for its
+// whole lifetime, so instances of a cluster can run side by side; offline
+// tools that change the store take it exclusively and fail with
+// ErrDataDirInUse while any server is running.
+func LockDataDir(dataDir string, exclusive bool) (*fileutil.FileLock, error) {
+	path := filepath.Join(dataDir, dataDirLockFile)
+	lockFile := fileutil.TryLockShared
+	if exclusive {
+		lockFile = fileutil.TryLock
+	}
+	l, err := lockFile(path)
+	if errors.Is(err, fileutil.ErrLocked) {
+		return nil, fmt.Errorf("%w: %s", ErrDataDirInUse, dataDir)
+	}
+	return l, err
+}
@@ -0,0 +1,95 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+func (m *Manager) Drain(reason string) {
+	m.mu.Lock()
+	m.draining = true
+	m.drainReason = reason
+	m.mu.Unlock()
+}
+
+func (m *Manager) StopDraining() {
+	m.mu.Lock()
+	m.draining = false
+	m.drainReason = ""
+	m.mu.Unlock()
+}
+
+func (m *Manager) DrainState() (bool, string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.draining, m.drainReason
+}
+
+func (m *Manager) Ping(ctx context.Context) error {
+	acquired := make(chan struct{})
+	go func() {
+		m.mu.RLock()
+		m.mu.RUnlock()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("task manager lock not acquired: %w", ctx.Err())
+	}
+}
+
+func (m *Manager) Pause() {
+	m.slots.setPaused(true)
+}
+
+func (m *Manager) Resume() {
+	m.slots.setPaused(false)
+}
+
+func (m *Manager) SetMaxConcurrentTasks(n int) error {
+	if n < 1 {
+		return fmt.Errorf("max concurrent tasks must be >= 1, got %d", n)
+	}
+	m.slots.resize(n)
+	return nil
+}
+
+func (m *Manager) ProcessingState() ProcessingState {
+	inUse, capacity, paused := m.slots.state()
+	draining, reason := m.DrainState()
+	return ProcessingState{
+		Draining:           draining,
+		DrainReason:        reason,
+		Paused:             paused,
+		MaxConcurrentTasks: capacity,
+		SlotsInUse:         inUse,
+		Workers:            m.InFlight(),
+	}
+}
+
+func (m *Manager) InFlight() []Worker {
+	m.mu.RLock()
+	workers := make([]Worker, 0, len(m.workers))
+	for id, startedAt := range m.workers {
+		workers = append(workers, Worker{TaskID: id, StartedAt: startedAt})
+	}
+	m.mu.RUnlock()
+	sort.Slice(workers, func(i, j int) bool { return workers[i].StartedAt.Before(workers[j].StartedAt) })
+	return workers
+}
+
+func (m *Manager) trackWorker(taskID string) {
+	m.mu.Lock()
+	m.workers[taskID] = time.Now()
+	m.mu.Unlock()
+}
+
+func (m *Manager) untrackWorker(taskID string) {
+	m.mu.Lock()
+	delete(m.workers, taskID)
+	m.mu.Unlock()
+}
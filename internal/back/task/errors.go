@@ -1,11 +1,73 @@
 package task
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrNoURLs       = errors.New("no urls provided")
-	ErrTaskNotFound = errors.New("task not found")
-	ErrTooManyFiles = errors.New("too many files: max 3 per task")
+	ErrNoURLs                 = errors.New("no urls provided")
+	ErrTaskNotFound           = errors.New("task not found")
+	ErrFileNotFound           = errors.New("file not found")
+	ErrTooManyFiles           = errors.New("too many files: max 3 per task")
+	ErrExtNotAllowed          = errors.New("extension not allowed")
+	ErrInvalidURL             = errors.New("invalid url: only http and https are supported")
+	ErrContentMismatch        = errors.New("content does not match extension")
+	ErrBusy                   = errors.New("server busy")
+	ErrInvalidState           = errors.New("invalid task state")
+	ErrArchiveNotReady        = errors.New("archive not ready")
+	ErrArchiveExpired         = errors.New("archive expired")
+	ErrUnsupportedFormat      = errors.New("unsupported archive format")
+	ErrUnsupportedCompression = errors.New("unsupported compression")
+	ErrTitleTooLong           = errors.New("title too long")
+	ErrDraining               = errors.New("server is draining")
 )
 
-func NewErrExtNotAllowed(ext string) error { return errors.New("extension not allowed: " + ext) }
+type ExtNotAllowedError struct {
+	Ext string
+}
+
+func (e *ExtNotAllowedError) Error() string { return ErrExtNotAllowed.Error() + ": " + e.Ext }
+
+func (e *ExtNotAllowedError) Is(target error) bool { return target == ErrExtNotAllowed }
+
+func NewErrExtNotAllowed(ext string) error { return &ExtNotAllowedError{Ext: ext} }
+
+type DrainingError struct {
+	Reason string
+}
+
+func (e *DrainingError) Error() string {
+	if e.Reason == "" {
+		return ErrDraining.Error()
+	}
+	return ErrDraining.Error() + ": " + e.Reason
+}
+
+func (e *DrainingError) Is(target error) bool { return target == ErrDraining }
+
+type ContentMismatchError struct {
+	Ext      string
+	Detected string
+}
+
+func (e *ContentMismatchError) Error() string {
+	return fmt.Sprintf("%s: %s looks like %s", ErrContentMismatch.Error(), e.Ext, e.Detected)
+}
+
+func (e *ContentMismatchError) Is(target error) bool { return target == ErrContentMismatch }
+
+type InvalidStateError struct {
+	TaskID string
+	Status Status
+}
+
+func (e *InvalidStateError) Error() string {
+	return fmt.Sprintf("%s: task %s is %s", ErrInvalidState.Error(), e.TaskID, e.Status)
+}
+
+func (e *InvalidStateError) Is(target error) bool { return target == ErrInvalidState }
+
+func NewErrInvalidState(taskID string, status Status) error {
+	return &InvalidStateError{TaskID: taskID, Status: status}
+}
@@ -0,0 +1,193 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"workmate/internal/back/storage"
+)
+
+// staleTempAge is how old a .tmp-* file left by an interrupted atomic write
+// must be before fsck treats it as garbage rather than a write in progress.
+const staleTempAge = 5 * time.Minute
+
+type FsckProblem string
+
+const (
+	ProblemMissingArchive  FsckProblem = "missing_archive"
+	ProblemMissingDir      FsckProblem = "missing_dir"
+	ProblemNewerSchema     FsckProblem = "newer_schema"
+	ProblemOrphanedArchive FsckProblem = "orphaned_archive"
+	ProblemOrphanedDir     FsckProblem = "orphaned_dir"
+	ProblemStaleTemp       FsckProblem = "stale_temp_file"
+	ProblemUnreadable      FsckProblem = "unreadable_record"
+)
+
+type FsckFinding struct {
+	TaskID  string      `json:"task_id,omitempty"`
+	Problem FsckProblem `json:"problem"`
+	Path    string      `json:"path,omitempty"`
+	Detail  string      `json:"detail,omitempty"`
+	Fixed   bool        `json:"fixed"`
+	FixErr  string      `json:"fix_error,omitempty"`
+}
+
+// Fsck cross-checks task records against the files under dataDir. With fix
+// set it repairs what it can:
+//   - ready tasks without an archive are marked failed
+//   - missing task directories are recreated
+//   - archives of tasks that are not ready, and directories without a record,
+//     are removed; a directory another instance has just reserved for a new
+//     task is left alone
+//   - stale .tmp-* files are removed
+//
+// Unreadable records and records written by a newer release are only
+// reported; LoadFromDisk quarantines the former and leaves the latter alone.
+// Fix refuses to run while the journal holds events the store does not
+// reflect yet, since the records it would act on are stale. With remote
+// archives a missing local copy is only a cache miss, so a ready task is
+// flagged only when archives has no object for it either.
+func Fsck(ctx context.Context, store TaskStore, archives storage.ArchiveStorage, dataDir string, fix bool) ([]FsckFinding, error) {
+	if fix {
+		pending, err := JournalPending(dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("check journal: %w", err)
+		}
+		if pending {
+			return nil, ErrJournalPending
+		}
+	}
+	tasks, report, err := store.LoadTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var findings []FsckFinding
+	add := func(f FsckFinding, repair func() error) {
+		if fix && repair != nil {
+			if err := repair(); err != nil {
+				f.FixErr = err.Error()
+			} else {
+				f.Fixed = true
+			}
+		}
+		findings = append(findings, f)
+	}
+
+	known := make(map[string]bool, len(tasks))
+	for _, failed := range report.Failed {
+		if failed.Path != "" {
+			// A directory without status.json is an orphan, not a bad record.
+			if _, err := os.Stat(failed.Path); errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+		}
+		known[failed.TaskID] = true
+		add(FsckFinding{TaskID: failed.TaskID, Problem: ProblemUnreadable, Path: failed.Path, Detail: failed.Reason}, nil)
+	}
+	for _, newer := range report.NewerSchema {
+		known[newer.TaskID] = true
+		add(FsckFinding{TaskID: newer.TaskID, Problem: ProblemNewerSchema, Path: newer.Path, Detail: newer.Reason}, nil)
+	}
+
+	for _, t := range tasks {
+		known[t.ID] = true
+		archivePath := store.ArchivePath(t.ID)
+		dir := filepath.Dir(archivePath)
+
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			add(FsckFinding{TaskID: t.ID, Problem: ProblemMissingDir, Path: dir}, func() error {
+				_, err := store.EnsureTaskDir(ctx, t.ID)
+				return err
+			})
+		}
+
+		_, statErr := os.Stat(archivePath)
+		hasArchive := statErr == nil
+		switch {
+		case t.Status == StatusReady && !hasArchive && !remoteArchiveExists(ctx, archives, t.ID):
+			add(FsckFinding{TaskID: t.ID, Problem: ProblemMissingArchive, Path: archivePath, Detail: "status is ready"}, func() error {
+				markArchiveLost(t)
+				return store.SaveTask(ctx, t)
+			})
+		case t.Status != StatusReady && t.Status != StatusInProgress && hasArchive:
+			add(FsckFinding{TaskID: t.ID, Problem: ProblemOrphanedArchive, Path: archivePath, Detail: "status is " + string(t.Status)}, func() error {
+				return os.Remove(archivePath)
+			})
+		}
+	}
+
+	root := filepath.Join(dataDir, "tasks")
+	entries, err := os.ReadDir(root)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return findings, fmt.Errorf("read tasks dir: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() || known[e.Name()] || isReserved(store, e.Name()) {
+			continue
+		}
+		dir := filepath.Join(root, e.Name())
+		problem := ProblemOrphanedDir
+		if _, err := os.Stat(filepath.Join(dir, "archive.zip")); err == nil {
+			problem = ProblemOrphanedArchive
+		}
+		add(FsckFinding{TaskID: e.Name(), Problem: problem, Path: dir, Detail: "no task record"}, func() error {
+			return os.RemoveAll(dir)
+		})
+	}
+
+	cutoff := time.Now().Add(-staleTempAge)
+	walkErr := filepath.WalkDir(dataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		add(FsckFinding{Problem: ProblemStaleTemp, Path: path, Detail: "modified " + info.ModTime().UTC().Format(time.RFC3339)}, func() error {
+			return os.Remove(path)
+		})
+		return nil
+	})
+	if walkErr != nil {
+		return findings, fmt.Errorf("scan temp files: %w", walkErr)
+	}
+	return findings, nil
+}
+
+func remoteArchiveExists(ctx context.Context, archives storage.ArchiveStorage, taskID string) bool {
+	if archives == nil || archives.Driver() == storage.DriverLocal {
+		return false
+	}
+	obj, err := archives.Open(ctx, taskID)
+	if err != nil {
+		return false
+	}
+	_ = obj.Close()
+	return true
+}
+
+func markArchiveLost(t *Task) {
+	t.Status = StatusFailed
+	t.ArchivePath = ""
+	t.ArchiveSHA256 = ""
+	t.ArchiveSize = 0
+	for i := range t.Files {
+		if t.Files[i].State != FileFailed {
+			t.Files[i].State = FileFailed
+			t.Files[i].Error = "archive missing"
+		}
+	}
+}
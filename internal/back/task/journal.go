@@ -0,0 +1,445 @@
+package task
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	fileutil "workmate/internal/back/file"
+	"workmate/internal/back/metrics"
+)
+
+type EventType string
+
+const (
+	EventCreated      EventType = "created"
+	EventFilesAdded   EventType = "files_added"
+	EventFileRemoved  EventType = "file_removed"
+	EventFileReplaced EventType = "file_replaced"
+	EventStarted      EventType = "started"
+	EventFileFinished EventType = "file_finished"
+	EventCompleted    EventType = "completed"
+	EventFailed       EventType = "failed"
+	EventDownloaded   EventType = "downloaded"
+	EventExpired      EventType = "expired"
+)
+
+const (
+	journalFile = "events.jsonl"
+	// asideFile holds the events a compaction is folding into the store. It
+	// is removed once the checkpoint covers them.
+	asideFile      = "events.jsonl.compacting"
+	checkpointFile = "checkpoint.json"
+
+	defaultCompactEvery = 1000
+)
+
+// Event is one journal line. It carries the full task record after the
+// change, so replay only needs the newest event per task.
+type Event struct {
+	Seq    uint64    `json:"seq"`
+	Time   time.Time `json:"time"`
+	Type   EventType `json:"type"`
+	TaskID string    `json:"task_id"`
+	File   *int      `json:"file,omitempty"`
+	Task   *Task     `json:"task"`
+}
+
+type checkpoint struct {
+	Seq uint64    `json:"seq"`
+	At  time.Time `json:"at"`
+}
+
+type JournalOptions struct {
+	Enabled bool
+	// CompactEvery triggers a snapshot after this many events.
+	CompactEvery int
+}
+
+// journal is an fsynced, append-only event log kept in DataDir/journal.
+// Compaction moves the log aside and starts a new one, then writes every
+// task to the store, records the last included sequence number in
+// checkpoint.json and only then drops the moved log, so a crash at any point
+// leaves either the old or the new snapshot replayable. Only the move holds
+// mu; appends continue while the snapshot is written.
+type journal struct {
+	mu sync.Mutex
+	// compactMu serializes compactions.
+	compactMu  sync.Mutex
+	dir        string
+	file       *os.File
+	seq        uint64
+	checkpoint uint64
+	pending    int
+}
+
+func openJournal(dir string) (*journal, error) {
+	if err := fileutil.EnsureDir(dir); err != nil {
+		return nil, fmt.Errorf("ensure journal dir: %w", err)
+	}
+	j := &journal{dir: dir}
+	if raw, err := os.ReadFile(filepath.Join(dir, checkpointFile)); err == nil {
+		var cp checkpoint
+		if err := json.Unmarshal(raw, &cp); err != nil {
+			return nil, fmt.Errorf("decode checkpoint: %w", err)
+		}
+		j.checkpoint = cp.Seq
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+	j.seq = j.checkpoint
+	if err := mergeAside(dir); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	j.file = f
+	if err := j.scanTail(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// scanTail finds the last sequence number and cuts off a torn final line
+// left by a crash in the middle of a write.
+func (j *journal) scanTail() error {
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(j.file)
+	var good int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				log.Warn().Int("bytes", len(line)).Msg("truncating torn journal tail")
+				if err := j.file.Truncate(good); err != nil {
+					return fmt.Errorf("truncate journal: %w", err)
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read journal: %w", err)
+		}
+		var ev Event
+		if err := json.Unmarshal(bytes.TrimSpace(line), &ev); err != nil {
+			return fmt.Errorf("journal offset %d: %w", good, err)
+		}
+		good += int64(len(line))
+		j.seq = max(j.seq, ev.Seq)
+		if ev.Seq > j.checkpoint {
+			j.pending++
+		}
+	}
+}
+
+// append writes the events with a single fsync and returns how many events
+// have accumulated since the last snapshot.
+func (j *journal) append(events ...Event) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var buf bytes.Buffer
+	for _, ev := range events {
+		j.seq++
+		ev.Seq = j.seq
+		if ev.Time.IsZero() {
+			ev.Time = time.Now().UTC()
+		}
+		line, err := json.Marshal(ev)
+		if err != nil {
+			return j.pending, fmt.Errorf("encode event: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if _, err := j.file.Write(buf.Bytes()); err != nil {
+		return j.pending, fmt.Errorf("write journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return j.pending, fmt.Errorf("sync journal: %w", err)
+	}
+	j.pending += len(events)
+	return j.pending, nil
+}
+
+// replay calls apply for every event newer than the last checkpoint, in
+// order.
+func (j *journal) replay(apply func(Event)) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.Open(filepath.Join(j.dir, journalFile))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	replayed, last := 0, j.checkpoint
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return replayed, fmt.Errorf("decode event: %w", err)
+		}
+		// Events merged back from an interrupted compaction may repeat.
+		if ev.Seq <= last {
+			continue
+		}
+		last = ev.Seq
+		apply(ev)
+		replayed++
+	}
+	return replayed, scanner.Err()
+}
+
+// compact snapshots the tasks returned by collect and drops the log they
+// cover. collect runs after the sequence number is captured, so every event
+// up to that number is already reflected in memory.
+func (j *journal) compact(ctx context.Context, store TaskStore, collect func() []*Task) (int, error) {
+	j.compactMu.Lock()
+	defer j.compactMu.Unlock()
+
+	j.mu.Lock()
+	upTo, moved := j.seq, j.pending
+	tasks := collect()
+	err := j.rotateLocked()
+	j.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := j.snapshot(ctx, store, tasks, upTo); err != nil {
+		// The moved events stay aside; the next compaction appends to them.
+		j.mu.Lock()
+		j.pending += moved
+		j.mu.Unlock()
+		return 0, err
+	}
+	return len(tasks), nil
+}
+
+// rotateLocked moves the log aside and starts an empty one. Events left aside
+// by a failed compaction stay in front of the moved ones.
+func (j *journal) rotateLocked() error {
+	current := filepath.Join(j.dir, journalFile)
+	aside := filepath.Join(j.dir, asideFile)
+	if _, err := os.Stat(aside); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(current, aside); err != nil {
+			return fmt.Errorf("move journal aside: %w", err)
+		}
+		f, err := os.OpenFile(current, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+		if err != nil {
+			_ = os.Rename(aside, current)
+			return fmt.Errorf("open journal: %w", err)
+		}
+		_ = j.file.Close()
+		j.file = f
+	} else {
+		if err := appendJournal(aside, j.file); err != nil {
+			return err
+		}
+		if err := j.file.Truncate(0); err != nil {
+			return fmt.Errorf("truncate journal: %w", err)
+		}
+		if err := j.file.Sync(); err != nil {
+			return fmt.Errorf("sync journal: %w", err)
+		}
+	}
+	j.pending = 0
+	return nil
+}
+
+// snapshot writes tasks to the store and the checkpoint, then removes the
+// events moved aside.
+func (j *journal) snapshot(ctx context.Context, store TaskStore, tasks []*Task, upTo uint64) error {
+	for _, t := range tasks {
+		if err := store.SaveTask(ctx, t); err != nil {
+			return fmt.Errorf("snapshot task %s: %w", t.ID, err)
+		}
+	}
+	cp := checkpoint{Seq: upTo, At: time.Now().UTC()}
+	if err := fileutil.WriteJSONAtomic(filepath.Join(j.dir, checkpointFile), cp); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	j.mu.Lock()
+	j.checkpoint = upTo
+	j.mu.Unlock()
+	if err := os.Remove(filepath.Join(j.dir, asideFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove compacted journal: %w", err)
+	}
+	return nil
+}
+
+// appendJournal copies the log in src to the end of the file at path.
+func appendJournal(path string, src *os.File) error {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("read journal: %w", err)
+	}
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open compacting journal: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return fmt.Errorf("append to compacting journal: %w", err)
+	}
+	return errors.Join(dst.Sync(), dst.Close())
+}
+
+// mergeAside puts the events of a compaction interrupted by a crash back in
+// front of the log: the log is appended to the moved events, which then
+// replace it. A torn last line, left by a crash while appending to the moved
+// events, is dropped; the events it held are still in the log.
+func mergeAside(dir string) error {
+	aside := filepath.Join(dir, asideFile)
+	moved, err := os.ReadFile(aside)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read compacting journal: %w", err)
+	}
+	if err := os.Truncate(aside, int64(bytes.LastIndexByte(moved, '\n')+1)); err != nil {
+		return fmt.Errorf("truncate compacting journal: %w", err)
+	}
+	current := filepath.Join(dir, journalFile)
+	if f, err := os.Open(current); err == nil {
+		err = appendJournal(aside, f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	if err := os.Rename(aside, current); err != nil {
+		return fmt.Errorf("merge compacting journal: %w", err)
+	}
+	return nil
+}
+
+func (j *journal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+func (m *Manager) compactEvery() int {
+	if m.journalOpts.CompactEvery > 0 {
+		return m.journalOpts.CompactEvery
+	}
+	return defaultCompactEvery
+}
+
+// Compact snapshots every task into the store and truncates the journal. It
+// is a no-op when the journal is disabled.
+func (m *Manager) Compact(ctx context.Context) error {
+	j := m.journal.Load()
+	if j == nil {
+		return nil
+	}
+	start := time.Now()
+	saved, err := j.compact(ctx, m.store, m.cloneTasks)
+	if err != nil {
+		metrics.StoreError("compact")
+		return err
+	}
+	log.Debug().Int("tasks", saved).Dur("took", time.Since(start)).Msg("journal compacted")
+	return nil
+}
+
+func (m *Manager) compactInBackground() {
+	if !m.compacting.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer m.compacting.Store(false)
+		if err := m.Compact(context.Background()); err != nil {
+			log.Error().Err(err).Msg("journal compaction failed")
+		}
+	}()
+}
+
+// CompactPeriodically compacts the journal every interval until ctx ends.
+func (m *Manager) CompactPeriodically(ctx context.Context, interval time.Duration) {
+	if m.journal.Load() == nil || interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if m.journalPending() > 0 {
+					m.compactInBackground()
+				}
+			}
+		}
+	}()
+}
+
+// CloseJournal writes a final snapshot and closes the journal file.
+func (m *Manager) CloseJournal(ctx context.Context) error {
+	j := m.journal.Load()
+	if j == nil {
+		return nil
+	}
+	err := m.Compact(ctx)
+	m.journal.Store(nil)
+	return errors.Join(err, j.close())
+}
+
+func (m *Manager) journalPending() int {
+	j := m.journal.Load()
+	if j == nil {
+		return 0
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.pending
+}
+
+func (m *Manager) cloneTasks() []*Task {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]*Task, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		out = append(out, t.clone())
+	}
+	return out
+}
+
+// JournalPending reports whether dataDir holds journal events that have not
+// been compacted into the store yet. Offline tools reading the store directly
+// would miss those changes.
+func JournalPending(dataDir string) (bool, error) {
+	for _, name := range []string{journalFile, asideFile} {
+		info, err := os.Stat(filepath.Join(dataDir, "journal", name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if info.Size() > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -2,25 +2,150 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"strings"
+
+	"workmate/internal/back/metrics"
 )
 
 func (m *Manager) LoadFromDisk() error {
 	if m.store == nil {
+		m.setStoreState(nil)
 		return nil
 	}
-	loadedTasks, err := m.store.LoadTasks(context.Background())
+	loadedTasks, report, err := m.store.LoadTasks(context.Background())
 	if err != nil {
-		return fmt.Errorf("load tasks: %w", err)
+		metrics.StoreError("load")
+		err = fmt.Errorf("load tasks: %w", err)
+		m.setStoreState(err)
+		return err
+	}
+	if len(report.Failed) > 0 {
+		if m.failOnCorrupt {
+			ids := make([]string, 0, len(report.Failed))
+			for _, f := range report.Failed {
+				ids = append(ids, f.TaskID)
+			}
+			err = fmt.Errorf("%w: %s", ErrCorruptRecords, strings.Join(ids, ", "))
+			m.setStoreState(err)
+			return err
+		}
+		report.Quarantined = m.quarantineFailed(context.Background(), report.Failed)
+	}
+	replayed := 0
+	if m.journalOpts.Enabled {
+		loadedTasks, replayed, err = m.replayJournal(loadedTasks)
+		if err != nil {
+			metrics.StoreError("journal")
+			err = fmt.Errorf("replay journal: %w", err)
+			m.setStoreState(err)
+			return err
+		}
 	}
+	var queued []string
 	for _, taskEntity := range loadedTasks {
-		if taskEntity.Status == StatusInProgress {
+		// In a cluster the task may be running on another instance; RunCluster
+		// takes it over once its lease expires.
+		if taskEntity.Status == StatusInProgress && m.cluster == nil {
 			taskEntity.Status = StatusFailed
-			_ = m.persistTask(taskEntity)
+			_ = m.persistTask(taskEntity, EventFailed)
 		}
 		m.mu.Lock()
 		m.tasks[taskEntity.ID] = taskEntity
 		m.mu.Unlock()
+		if m.cluster != nil {
+			m.cluster.markFetched(taskEntity.ID)
+		} else if needsProcessing(taskEntity) {
+			queued = append(queued, taskEntity.ID)
+		}
+	}
+	if replayed > 0 {
+		if err := m.Compact(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("compaction after replay failed")
+		}
+	}
+	summary := log.Info()
+	if len(report.Failed) > 0 || len(report.NewerSchema) > 0 {
+		summary = log.Warn()
+	}
+	summary.Int("loaded", report.Loaded).Int("migrated", len(report.Migrated)).Int("quarantined", len(report.Quarantined)).
+		Int("newer_schema", len(report.NewerSchema)).
+		Int("replayed_events", replayed).Int("schema_version", CurrentSchemaVersion).Msg("task records loaded")
+	m.mu.Lock()
+	m.loadReport = report
+	m.mu.Unlock()
+	m.setStoreState(nil)
+	m.enforceQuota(context.Background())
+	// A full task that was still waiting for a slot when the process stopped
+	// cannot be edited, so it has to be queued again.
+	for _, id := range queued {
+		log.Info().Str("task_id", id).Msg("requeueing task left in the queue")
+		m.launchProcessing(context.Background(), id)
+	}
+	return nil
+}
+
+// LoadReport returns the outcome of the last LoadFromDisk.
+func (m *Manager) LoadReport() LoadReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.loadReport
+}
+
+// replayJournal opens the journal and applies every event newer than the
+// last snapshot on top of the tasks loaded from the store.
+func (m *Manager) replayJournal(snapshot []*Task) ([]*Task, int, error) {
+	j, err := openJournal(filepath.Join(m.dataDir, "journal"))
+	if err != nil {
+		return nil, 0, err
+	}
+	byID := make(map[string]*Task, len(snapshot))
+	order := make([]string, 0, len(snapshot))
+	for _, t := range snapshot {
+		byID[t.ID] = t
+		order = append(order, t.ID)
+	}
+	replayed, err := j.replay(func(ev Event) {
+		if ev.Task == nil {
+			return
+		}
+		if _, known := byID[ev.TaskID]; !known {
+			order = append(order, ev.TaskID)
+		}
+		byID[ev.TaskID] = ev.Task
+	})
+	if err != nil {
+		_ = j.close()
+		return nil, 0, err
+	}
+	m.journal.Store(j)
+	if replayed > 0 {
+		log.Info().Int("events", replayed).Msg("replayed task journal")
+	}
+	tasks := make([]*Task, 0, len(order))
+	for _, id := range order {
+		tasks = append(tasks, byID[id])
+	}
+	return tasks, replayed, nil
+}
+
+func (m *Manager) setStoreState(err error) {
+	m.mu.Lock()
+	m.storeLoaded = err == nil
+	m.storeErr = err
+	m.mu.Unlock()
+}
+
+func (m *Manager) StoreReady() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.storeErr != nil {
+		return m.storeErr
+	}
+	if !m.storeLoaded {
+		return errors.New("store not loaded yet")
 	}
 	return nil
 }
@@ -2,29 +2,61 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/url"
+	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"workmate/internal/back/archive"
+	"workmate/internal/back/audit"
 	fileutil "workmate/internal/back/file"
+	"workmate/internal/back/logging"
+	"workmate/internal/back/metrics"
+	"workmate/internal/back/storage"
+	"workmate/internal/back/tracing"
 
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var log = logging.Package("task")
+
 type Manager struct {
 	mu                sync.RWMutex
 	tasks             map[string]*Task
 	dataDir           string
-	allowedExtensions map[string]struct{}
-	semaphore         chan struct{}
+	allowedExtensions atomic.Pointer[extensionSet]
+	downloadTimeout   atomic.Int64
+	slots             *slotPool
+	workers           map[string]time.Time
 	buildArchive      func(ctx context.Context, destZipPath string, urls []string) ([]archive.Result, error)
 	workersWG         sync.WaitGroup
 	baseCtx           context.Context
 	store             TaskStore
+	storeLoaded       bool
+	storeErr          error
+	draining          bool
+	drainReason       string
+	loadReport        LoadReport
+	failOnCorrupt     bool
+	journalOpts       JournalOptions
+	journal           atomic.Pointer[journal]
+	compacting        atomic.Bool
+	archives          storage.ArchiveStorage
+	quota             QuotaOptions
+	quotaMu           sync.Mutex
+	freeSpace         func(dir string) (uint64, error)
+	cluster           *cluster
+	audit             *audit.Log
 }
 
 func NewManager() *Manager {
@@ -36,78 +68,237 @@ func NewManager() *Manager {
 }
 
 func NewManagerWithOptions(opts Options) *Manager {
-	allowed := make(map[string]struct{}, len(opts.AllowedExtensions))
-	for _, ext := range opts.AllowedExtensions {
+	if opts.MaxConcurrentTasks <= 0 {
+		opts.MaxConcurrentTasks = 1
+	}
+	m := &Manager{
+		tasks:         make(map[string]*Task),
+		dataDir:       opts.DataDir,
+		slots:         newSlotPool(opts.MaxConcurrentTasks),
+		workers:       make(map[string]time.Time),
+		buildArchive:  archive.BuildArchive,
+		baseCtx:       context.Background(),
+		store:         opts.Store,
+		journalOpts:   opts.Journal,
+		failOnCorrupt: opts.FailOnCorrupt,
+		archives:      opts.Archives,
+		quota:         opts.Quota,
+		freeSpace:     fileutil.FreeSpace,
+		audit:         opts.Audit,
+	}
+	if m.store == nil {
+		m.store = NewFileStore(opts.DataDir)
+	}
+	if m.archives == nil {
+		m.archives = storage.NewLocal(m.store.ArchivePath)
+	}
+	if opts.Cluster.Enabled {
+		m.cluster = newCluster(opts.DataDir, opts.Cluster)
+	}
+	m.SetAllowedExtensions(opts.AllowedExtensions)
+	m.SetDownloadTimeout(opts.DownloadTimeout)
+	return m
+}
+
+func (m *Manager) SetAllowedExtensions(extensions []string) {
+	allowed := make(extensionSet, len(extensions))
+	for _, ext := range extensions {
 		ext = strings.ToLower(ext)
 		if !strings.HasPrefix(ext, ".") {
 			ext = "." + ext
 		}
 		allowed[ext] = struct{}{}
 	}
-	if opts.MaxConcurrentTasks <= 0 {
-		opts.MaxConcurrentTasks = 1
-	}
-	return &Manager{
-		tasks:             make(map[string]*Task),
-		dataDir:           opts.DataDir,
-		allowedExtensions: allowed,
-		semaphore:         make(chan struct{}, opts.MaxConcurrentTasks),
-		buildArchive:      archive.BuildArchive,
-		baseCtx:           context.Background(),
-		store:             NewFileStore(opts.DataDir),
+	m.allowedExtensions.Store(&allowed)
+}
+
+func (m *Manager) AllowedExtensions() []string {
+	allowed := *m.allowedExtensions.Load()
+	out := make([]string, 0, len(allowed))
+	for ext := range allowed {
+		out = append(out, ext)
 	}
+	sort.Strings(out)
+	return out
+}
+
+func (m *Manager) SetDownloadTimeout(timeout time.Duration) {
+	m.downloadTimeout.Store(int64(timeout))
 }
 
 func (m *Manager) IsBusy() bool {
-	return len(m.semaphore) >= cap(m.semaphore)
+	inUse, capacity, _ := m.slots.state()
+	return inUse >= capacity
 }
 
-func (m *Manager) CreateTask() *Task {
-	createdAt := time.Now()
-	baseID := createdAt.Format("2006-01-02_15-04-05")
-	newTask := &Task{
-		ID:        baseID,
-		Status:    StatusCreated,
-		CreatedAt: createdAt,
-		Files:     make([]FileRef, 0, MaxFilesPerTask),
+func (m *Manager) SlotUsage() (int, int) {
+	inUse, capacity, _ := m.slots.state()
+	return inUse, capacity
+}
+
+func (m *Manager) CountByStatus() map[string]int {
+	counts := map[string]int{
+		string(StatusCreated):    0,
+		string(StatusInProgress): 0,
+		string(StatusReady):      0,
+		string(StatusFailed):     0,
+		string(StatusExpired):    0,
+	}
+	m.mu.RLock()
+	for _, t := range m.tasks {
+		counts[string(t.Status)]++
 	}
+	m.mu.RUnlock()
+	return counts
+}
 
-	m.updateTaskTitle(newTask)
+func (m *Manager) CreateTask() *Task {
+	newTask := m.newTask(CreateOptions{})
 
 	m.mu.Lock()
-	finalID := baseID
-	if _, exists := m.tasks[finalID]; exists {
-		suffix := 1
-		for {
-			candidate := fmt.Sprintf("%s-%02d", baseID, suffix)
-			if _, ok := m.tasks[candidate]; !ok {
-				finalID = candidate
-				break
-			}
-			suffix++
-		}
-	}
-	newTask.ID = finalID
-	m.tasks[finalID] = newTask
+	m.registerTaskLocked(newTask)
 	m.mu.Unlock()
 
-	if err := m.persistTask(newTask); err != nil {
+	if err := m.persistTask(newTask, EventCreated); err != nil {
 		log.Warn().Str("task_id", newTask.ID).Err(err).Msg("persist task failed")
 	}
 	return newTask
 }
 
+func (m *Manager) CreateTaskWithOptions(ctx context.Context, opts CreateOptions) (*Task, error) {
+	if draining, reason := m.DrainState(); draining {
+		return nil, &DrainingError{Reason: reason}
+	}
+	if m.IsBusy() {
+		return nil, ErrBusy
+	}
+	opts, err := m.normalizeCreateOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	newTask := m.newTask(opts)
+	newTask.RequestID = logging.RequestIDFromContext(ctx)
+
+	m.mu.Lock()
+	m.registerTaskLocked(newTask)
+	m.mu.Unlock()
+
+	if err := m.saveTask(ctx, newTask, EventCreated); err != nil {
+		m.mu.Lock()
+		delete(m.tasks, newTask.ID)
+		m.mu.Unlock()
+		m.releaseReservation(newTask.ID)
+		return nil, err
+	}
+
+	if len(newTask.Files) == MaxFilesPerTask {
+		// Processing may start changing the task as soon as it is launched.
+		m.mu.RLock()
+		result := newTask.clone()
+		m.mu.RUnlock()
+		m.launchProcessing(ctx, newTask.ID)
+		return result, nil
+	}
+	return newTask, nil
+}
+
+// GetTask returns a copy of the task taken under the manager lock, so the
+// caller can read it while processing or a cluster reload changes the task.
 func (m *Manager) GetTask(taskID string) (*Task, bool) {
+	m.syncTask(context.Background(), taskID)
 	m.mu.RLock()
+	defer m.mu.RUnlock()
 	foundTask, taskFound := m.tasks[taskID]
+	if !taskFound {
+		return nil, false
+	}
+	return foundTask.clone(), true
+}
+
+func (t *Task) clone() *Task {
+	c := *t
+	c.Files = slices.Clone(t.Files)
+	return &c
+}
+
+// ReadyArchivePath returns the local path of a ready archive, fetching it
+// from the archive storage first when this node has no local copy.
+func (m *Manager) ReadyArchivePath(ctx context.Context, taskID string) (string, error) {
+	m.syncTask(ctx, taskID)
+	m.mu.RLock()
+	foundTask, taskFound := m.tasks[taskID]
+	if !taskFound {
+		m.mu.RUnlock()
+		return "", ErrTaskNotFound
+	}
+	if foundTask.Status == StatusExpired {
+		m.mu.RUnlock()
+		return "", ErrArchiveExpired
+	}
+	if foundTask.Status != StatusReady || foundTask.ArchivePath == "" {
+		m.mu.RUnlock()
+		return "", ErrArchiveNotReady
+	}
+	archivePath := foundTask.ArchivePath
 	m.mu.RUnlock()
-	return foundTask, taskFound
+	return archivePath, m.ensureLocalArchive(ctx, taskID, archivePath)
+}
+
+func (m *Manager) ArchivedFile(ctx context.Context, taskID string, index int) (string, string, error) {
+	m.syncTask(ctx, taskID)
+	m.mu.RLock()
+	foundTask, taskFound := m.tasks[taskID]
+	if !taskFound {
+		m.mu.RUnlock()
+		return "", "", ErrTaskNotFound
+	}
+	if foundTask.Status == StatusExpired {
+		m.mu.RUnlock()
+		return "", "", ErrArchiveExpired
+	}
+	if foundTask.Status != StatusReady || foundTask.ArchivePath == "" {
+		m.mu.RUnlock()
+		return "", "", ErrArchiveNotReady
+	}
+	if index < 0 || index >= len(foundTask.Files) {
+		m.mu.RUnlock()
+		return "", "", ErrFileNotFound
+	}
+	fileRef := foundTask.Files[index]
+	archivePath := foundTask.ArchivePath
+	m.mu.RUnlock()
+	if fileRef.State != FileOK || fileRef.Filename == "" {
+		return "", "", fmt.Errorf("%w: file was not archived: %s", ErrFileNotFound, fileRef.Error)
+	}
+	return archivePath, fileRef.Filename, m.ensureLocalArchive(ctx, taskID, archivePath)
+}
+
+func (m *Manager) ensureLocalArchive(ctx context.Context, taskID, archivePath string) error {
+	if _, err := os.Stat(archivePath); err == nil || m.archives.Driver() == storage.DriverLocal {
+		return nil
+	}
+	return storage.Fetch(ctx, m.archives, taskID, archivePath)
+}
+
+// Archives returns the storage finished archives are published to.
+func (m *Manager) Archives() storage.ArchiveStorage {
+	return m.archives
 }
 
 func (m *Manager) AddFiles(taskID string, urls []string) (*Task, error) {
+	return m.AddFilesContext(context.Background(), taskID, urls)
+}
+
+func (m *Manager) AddFilesContext(ctx context.Context, taskID string, urls []string) (*Task, error) {
 	if len(urls) == 0 {
 		return nil, ErrNoURLs
 	}
+	unlock, err := m.lockTask(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	m.mu.Lock()
 	currentTask, taskFound := m.tasks[taskID]
@@ -115,38 +306,267 @@ func (m *Manager) AddFiles(taskID string, urls []string) (*Task, error) {
 		m.mu.Unlock()
 		return nil, ErrTaskNotFound
 	}
-	if len(currentTask.Files)+len(urls) > MaxFilesPerTask {
+	if currentTask.Status != StatusCreated {
+		m.mu.Unlock()
+		return nil, NewErrInvalidState(taskID, currentTask.Status)
+	}
+	if err := m.validateURLs(len(currentTask.Files), urls); err != nil {
 		m.mu.Unlock()
-		return nil, ErrTooManyFiles
+		return nil, err
 	}
 
 	for _, rawURL := range urls {
-		fileExtension := strings.ToLower(filepath.Ext(strings.TrimSpace(rawURL)))
-		if _, allowed := m.allowedExtensions[fileExtension]; !allowed {
-			m.mu.Unlock()
-			return nil, NewErrExtNotAllowed(fileExtension)
-		}
-		currentTask.Files = append(currentTask.Files, FileRef{URL: rawURL, State: FilePending})
+		currentTask.Files = append(currentTask.Files, FileRef{URL: rawURL, State: FilePending, Source: SourceURL})
 	}
 
 	m.updateTaskTitle(currentTask)
+	// Processing may start changing the task as soon as it is launched.
+	result := currentTask.clone()
 	m.mu.Unlock()
 
-	if err := m.persistTask(currentTask); err != nil {
+	if err := m.saveTask(ctx, currentTask, EventFilesAdded); err != nil {
 		log.Warn().Str("task_id", currentTask.ID).Err(err).Msg("persist after add files failed")
 		return nil, err
 	}
 
-	if len(currentTask.Files) == MaxFilesPerTask {
-		m.semaphore <- struct{}{}
-		m.workersWG.Add(1)
+	if len(result.Files) == MaxFilesPerTask {
+		m.launchProcessing(ctx, taskID)
+	}
+
+	return result, nil
+}
+
+func (m *Manager) RemoveFile(taskID string, index int) (*Task, error) {
+	unlock, err := m.lockTask(context.Background(), taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	m.mu.Lock()
+	currentTask, err := m.editableTaskLocked(taskID, index)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	removed := currentTask.Files[index]
+	currentTask.Files = append(currentTask.Files[:index], currentTask.Files[index+1:]...)
+	m.updateTaskTitle(currentTask)
+	m.mu.Unlock()
+
+	if err := m.persistTask(currentTask, EventFileRemoved); err != nil {
+		log.Warn().Str("task_id", taskID).Err(err).Msg("persist after remove file failed")
+		return nil, err
+	}
+	removeUpload(m.uploadDir(taskID), removed)
+	return currentTask, nil
+}
+
+func (m *Manager) ReplaceFile(taskID string, index int, rawURL string) (*Task, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return nil, ErrNoURLs
+	}
+	unlock, err := m.lockTask(context.Background(), taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	m.mu.Lock()
+	currentTask, err := m.editableTaskLocked(taskID, index)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	if err := m.validateURLs(0, []string{rawURL}); err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	replaced := currentTask.Files[index]
+	currentTask.Files[index] = FileRef{URL: rawURL, State: FilePending, Source: SourceURL}
+	m.updateTaskTitle(currentTask)
+	m.mu.Unlock()
+
+	if err := m.persistTask(currentTask, EventFileReplaced); err != nil {
+		log.Warn().Str("task_id", taskID).Err(err).Msg("persist after replace file failed")
+		return nil, err
+	}
+	removeUpload(m.uploadDir(taskID), replaced)
+	return currentTask, nil
+}
+
+// editableTaskLocked returns the task if its file list may still change.
+// A created task holding MaxFilesPerTask files is already queued for
+// processing, so it is treated as not editable too.
+func (m *Manager) editableTaskLocked(taskID string, index int) (*Task, error) {
+	currentTask, taskFound := m.tasks[taskID]
+	if !taskFound {
+		return nil, ErrTaskNotFound
+	}
+	if currentTask.Status != StatusCreated || len(currentTask.Files) >= MaxFilesPerTask {
+		return nil, NewErrInvalidState(taskID, currentTask.Status)
+	}
+	if index < 0 || index >= len(currentTask.Files) {
+		return nil, ErrFileNotFound
+	}
+	return currentTask, nil
+}
+
+func RemainingSlots(t *Task) int {
+	if t.Status != StatusCreated {
+		return 0
+	}
+	return MaxFilesPerTask - len(t.Files)
+}
+
+func (m *Manager) newTask(opts CreateOptions) *Task {
+	createdAt := time.Now()
+	newTask := &Task{
+		SchemaVersion: CurrentSchemaVersion,
+		ID:            createdAt.Format("2006-01-02_15-04-05"),
+		Status:        StatusCreated,
+		CreatedAt:     createdAt,
+		Files:         make([]FileRef, 0, MaxFilesPerTask),
+		CustomTitle:   opts.Title,
+		Format:        opts.Format,
+		Compression:   opts.Compression,
+	}
+	for _, rawURL := range opts.URLs {
+		newTask.Files = append(newTask.Files, FileRef{URL: rawURL, State: FilePending, Source: SourceURL})
+	}
+	m.updateTaskTitle(newTask)
+	return newTask
+}
+
+func (m *Manager) registerTaskLocked(newTask *Task) {
+	baseID := newTask.ID
+	finalID := baseID
+	for suffix := 1; !m.idAvailableLocked(finalID); suffix++ {
+		finalID = fmt.Sprintf("%s-%02d", baseID, suffix)
+	}
+	newTask.ID = finalID
+	m.tasks[finalID] = newTask
+}
+
+// idAvailableLocked reports whether a new task may take id. Instances sharing
+// DataDir may pick the same id in the same second, so in cluster mode the
+// task directory is created here as the reservation.
+func (m *Manager) idAvailableLocked(id string) bool {
+	if _, exists := m.tasks[id]; exists {
+		return false
+	}
+	if m.cluster == nil {
+		return true
+	}
+	dir := filepath.Dir(m.store.ArchivePath(id))
+	if err := fileutil.EnsureDir(filepath.Dir(dir)); err != nil {
+		return true
+	}
+	err := os.Mkdir(dir, 0o750)
+	return err == nil || !errors.Is(err, fs.ErrExist)
+}
+
+// releaseReservation removes the directory idAvailableLocked reserved for a
+// task that was never saved.
+func (m *Manager) releaseReservation(id string) {
+	if m.cluster == nil {
+		return
+	}
+	if err := os.RemoveAll(filepath.Dir(m.store.ArchivePath(id))); err != nil {
+		log.Warn().Str("task_id", id).Err(err).Msg("remove task id reservation failed")
+	}
+}
+
+func (m *Manager) normalizeCreateOptions(opts CreateOptions) (CreateOptions, error) {
+	opts.Title = strings.TrimSpace(opts.Title)
+	if utf8.RuneCountInString(opts.Title) > MaxTitleLength {
+		return opts, ErrTitleTooLong
+	}
+
+	switch opts.Format {
+	case "":
+		opts.Format = FormatZip
+	case FormatZip:
+	default:
+		return opts, fmt.Errorf("%w: %s", ErrUnsupportedFormat, opts.Format)
+	}
+
+	switch opts.Compression {
+	case "":
+		opts.Compression = CompressionDeflate
+	case CompressionDeflate, CompressionStore:
+	default:
+		return opts, fmt.Errorf("%w: %s", ErrUnsupportedCompression, opts.Compression)
+	}
+
+	urls := make([]string, 0, len(opts.URLs))
+	for _, rawURL := range opts.URLs {
+		if trimmed := strings.TrimSpace(rawURL); trimmed != "" {
+			urls = append(urls, trimmed)
+		}
+	}
+	if err := m.validateURLs(0, urls); err != nil {
+		return opts, err
+	}
+	opts.URLs = urls
+	return opts, nil
+}
+
+func (m *Manager) validateURLs(existing int, urls []string) error {
+	if existing+len(urls) > MaxFilesPerTask {
+		return ErrTooManyFiles
+	}
+	for _, rawURL := range urls {
+		parsed, err := url.Parse(strings.TrimSpace(rawURL))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%w: %s", ErrInvalidURL, rawURL)
+		}
+		if err := m.validateExtension(parsed.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) validateExtension(name string) error {
+	fileExtension := strings.ToLower(filepath.Ext(strings.TrimSpace(name)))
+	if _, allowed := (*m.allowedExtensions.Load())[fileExtension]; !allowed {
+		return NewErrExtNotAllowed(fileExtension)
+	}
+	return nil
+}
+
+func (m *Manager) launchProcessing(ctx context.Context, taskID string) {
+	_, queueSpan := tracing.Tracer().Start(ctx, "task.queue", trace.WithAttributes(attribute.String("task.id", taskID)))
+	origin := trace.SpanContextFromContext(ctx)
+	requestID := logging.RequestIDFromContext(ctx)
+	if !m.claimTask(ctx, taskID) {
+		queueSpan.End()
+		return
+	}
+
+	m.workersWG.Add(1)
+	if m.slots.tryAcquire() {
+		queueSpan.End()
 		go func() {
 			defer m.workersWG.Done()
-			m.startProcessing(taskID, true)
+			m.startProcessing(taskID, origin, requestID)
 		}()
+		return
 	}
 
-	return currentTask, nil
+	go func() {
+		defer m.workersWG.Done()
+		err := m.slots.acquire(m.processingContext())
+		queueSpan.End()
+		if err != nil {
+			log.Ctx(ctx).Warn().Str("task_id", taskID).Err(err).Msg("task left the queue without a slot")
+			m.endClusterWork(taskID)
+			return
+		}
+		m.startProcessing(taskID, origin, requestID)
+	}()
 }
 
 func (m *Manager) SetBaseContext(ctx context.Context) {
@@ -155,6 +575,15 @@ func (m *Manager) SetBaseContext(ctx context.Context) {
 	m.mu.Unlock()
 }
 
+func (m *Manager) processingContext() context.Context {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.baseCtx == nil {
+		return context.Background()
+	}
+	return m.baseCtx
+}
+
 func (m *Manager) WaitAll(ctx context.Context) bool {
 	done := make(chan struct{})
 	go func() {
@@ -175,11 +604,40 @@ func (m *Manager) UseArchiveBuilder(builder func(ctx context.Context, destZipPat
 	m.mu.Unlock()
 }
 
-func (m *Manager) persistTask(taskEntity *Task) error {
+func (m *Manager) persistTask(taskEntity *Task, eventType EventType) error {
+	return m.saveTask(context.Background(), taskEntity, eventType)
+}
+
+func (m *Manager) saveTask(ctx context.Context, taskEntity *Task, eventType EventType) error {
+	return m.recordEvents(ctx, taskEntity, Event{Type: eventType})
+}
+
+// recordEvents appends the events to the journal when it is enabled and
+// otherwise rewrites the task snapshot in the store.
+func (m *Manager) recordEvents(ctx context.Context, taskEntity *Task, events ...Event) error {
+	if j := m.journal.Load(); j != nil {
+		for i := range events {
+			events[i].TaskID = taskEntity.ID
+			events[i].Task = taskEntity
+		}
+		pending, err := j.append(events...)
+		if err != nil {
+			metrics.StoreError("journal")
+			return fmt.Errorf("journal append: %w", err)
+		}
+		if pending >= m.compactEvery() {
+			m.compactInBackground()
+		}
+		return nil
+	}
 	if m.store != nil {
-		if err := m.store.SaveTask(context.Background(), taskEntity); err != nil {
+		if err := m.store.SaveTask(ctx, taskEntity); err != nil {
+			metrics.StoreError("save")
 			return fmt.Errorf("store save task: %w", err)
 		}
+		if m.cluster != nil {
+			m.cluster.markFetched(taskEntity.ID)
+		}
 		return nil
 	}
 
@@ -195,11 +653,18 @@ func (m *Manager) persistTask(taskEntity *Task) error {
 }
 
 func (m *Manager) updateTaskTitle(t *Task) {
+	if t.CustomTitle != "" {
+		t.Title = t.CustomTitle
+		return
+	}
 	timestamp := t.CreatedAt.Local().Format("2006-01-02 15:04")
 
 	seen := make(map[string]struct{}, len(t.Files))
 	hosts := make([]string, 0, len(t.Files))
 	for _, f := range t.Files {
+		if f.Source == SourceUpload {
+			continue
+		}
 		parsed, err := url.Parse(strings.TrimSpace(f.URL))
 		if err != nil || parsed.Hostname() == "" {
 			continue
@@ -4,12 +4,24 @@ import (
 	"archive/zip"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
 	archive "workmate/internal/back/archive"
+	"workmate/internal/back/audit"
+	fileutil "workmate/internal/back/file"
 )
 
 func newTestManager(t *testing.T) *Manager {
@@ -57,11 +69,38 @@ func TestAddFilesValidationErrors(t *testing.T) {
 		t.Fatalf("expected extension not allowed error, got %v", err)
 	}
 
+	_, err := m.AddFiles(taskEntity.ID, []string{"https://e.org/a.pdf", "https://e.org/b.exe"})
+	var extErr *ExtNotAllowedError
+	if !errors.As(err, &extErr) || extErr.Ext != ".exe" || !errors.Is(err, ErrExtNotAllowed) {
+		t.Fatalf("expected ExtNotAllowedError for .exe, got %v", err)
+	}
+	if len(taskEntity.Files) != 0 {
+		t.Fatalf("rejected batch must not be partially applied, got %d files", len(taskEntity.Files))
+	}
+
 	if _, err := m.AddFiles(taskEntity.ID, []string{"https://e.org/a.pdf", "https://e.org/b.jpeg", "https://e.org/c.pdf", "https://e.org/d.pdf"}); !errors.Is(err, ErrTooManyFiles) {
 		t.Fatalf("expected ErrTooManyFiles, got %v", err)
 	}
 }
 
+func TestAddFilesRejectsNonCreatedTask(t *testing.T) {
+	m := newTestManager(t)
+	m.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		return make([]archive.Result, len(urls)), nil
+	})
+	tsk := m.CreateTask()
+	if _, err := m.AddFiles(tsk.ID, []string{"https://e.org/a.pdf", "https://e.org/b.pdf", "https://e.org/c.pdf"}); err != nil {
+		t.Fatalf("add files: %v", err)
+	}
+	m.WaitAll(context.Background())
+
+	_, err := m.AddFiles(tsk.ID, []string{"https://e.org/d.pdf"})
+	var stateErr *InvalidStateError
+	if !errors.As(err, &stateErr) || stateErr.TaskID != tsk.ID || !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected InvalidStateError, got %v", err)
+	}
+}
+
 func TestProcessingFlowReadyAndArchivePath(t *testing.T) {
 	m := newTestManager(t)
 
@@ -141,10 +180,10 @@ func TestPersistAndLoadFromDisk(t *testing.T) {
 
 	t1 := &Task{ID: "t1", Status: StatusInProgress, CreatedAt: time.Now()}
 	t2 := &Task{ID: "t2", Status: StatusReady, CreatedAt: time.Now()}
-	if err := m.persistTask(t1); err != nil {
+	if err := m.persistTask(t1, EventStarted); err != nil {
 		t.Fatalf("persist t1: %v", err)
 	}
-	if err := m.persistTask(t2); err != nil {
+	if err := m.persistTask(t2, EventCompleted); err != nil {
 		t.Fatalf("persist t2: %v", err)
 	}
 
@@ -159,3 +198,741 @@ func TestPersistAndLoadFromDisk(t *testing.T) {
 		t.Fatalf("expected t2 ready after load, got: %+v, ok=%v", got, ok)
 	}
 }
+
+func TestLoadFromDiskRequeuesFullCreatedTask(t *testing.T) {
+	dataDir := t.TempDir()
+	m := NewManagerWithOptions(Options{DataDir: dataDir, AllowedExtensions: []string{".pdf"}, MaxConcurrentTasks: 1})
+
+	queued := &Task{ID: "t1", Status: StatusCreated, CreatedAt: time.Now()}
+	for i := 0; i < MaxFilesPerTask; i++ {
+		queued.Files = append(queued.Files, FileRef{URL: fmt.Sprintf("http://example.com/%d.pdf", i), State: FilePending, Source: SourceURL})
+	}
+	if err := m.persistTask(queued, EventFilesAdded); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+
+	m2 := NewManagerWithOptions(Options{DataDir: dataDir, AllowedExtensions: []string{".pdf"}, MaxConcurrentTasks: 1})
+	m2.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		if err := writeTestZip(dest, 1); err != nil {
+			return nil, err
+		}
+		res := make([]archive.Result, len(urls))
+		for i := range res {
+			res[i].Filename = "f.pdf"
+		}
+		return res, nil
+	})
+	if err := m2.LoadFromDisk(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	waitForStatus(t, m2, "t1", StatusReady)
+}
+
+func TestCreateTaskWithOptionsValidatesBeforeRegistering(t *testing.T) {
+	m := newTestManager(t)
+
+	cases := []struct {
+		name string
+		opts CreateOptions
+		want error
+	}{
+		{"bad extension", CreateOptions{URLs: []string{"https://e.org/a.pdf", "https://e.org/b.exe"}}, ErrExtNotAllowed},
+		{"too many urls", CreateOptions{URLs: []string{"https://e.org/a.pdf", "https://e.org/b.pdf", "https://e.org/c.pdf", "https://e.org/d.pdf"}}, ErrTooManyFiles},
+		{"bad format", CreateOptions{Format: "rar"}, ErrUnsupportedFormat},
+		{"bad compression", CreateOptions{Compression: "lzma"}, ErrUnsupportedCompression},
+		{"long title", CreateOptions{Title: strings.Repeat("x", MaxTitleLength+1)}, ErrTitleTooLong},
+	}
+	for _, c := range cases {
+		if _, err := m.CreateTaskWithOptions(context.Background(), c.opts); !errors.Is(err, c.want) {
+			t.Fatalf("%s: expected %v, got %v", c.name, c.want, err)
+		}
+	}
+
+	m.mu.RLock()
+	registered := len(m.tasks)
+	m.mu.RUnlock()
+	if registered != 0 {
+		t.Fatalf("expected no tasks registered after validation errors, got %d", registered)
+	}
+}
+
+func TestCreateTaskWithOptionsStartsProcessing(t *testing.T) {
+	m := newTestManager(t)
+	var gotCompression uint16
+	m.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		gotCompression = archive.CompressionFromContext(ctx)
+		if err := writeTestZip(dest, 0); err != nil {
+			return nil, err
+		}
+		return make([]archive.Result, len(urls)), nil
+	})
+
+	tsk, err := m.CreateTaskWithOptions(context.Background(), CreateOptions{
+		URLs:        []string{"https://e.org/a.pdf", "https://e.org/b.jpeg", "https://e.org/c.pdf"},
+		Title:       "  Quarterly reports  ",
+		Compression: CompressionStore,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if tsk.Title != "Quarterly reports" {
+		t.Fatalf("expected custom title, got %q", tsk.Title)
+	}
+	if tsk.Format != FormatZip {
+		t.Fatalf("expected default format zip, got %q", tsk.Format)
+	}
+
+	if !m.WaitAll(context.Background()) {
+		t.Fatalf("expected workers to finish")
+	}
+	got, _ := m.GetTask(tsk.ID)
+	if got.Status != StatusReady {
+		t.Fatalf("expected ready, got %s", got.Status)
+	}
+	if gotCompression != zip.Store {
+		t.Fatalf("expected store compression in builder context, got %d", gotCompression)
+	}
+}
+
+func TestRemoveAndReplaceFile(t *testing.T) {
+	m := newTestManager(t)
+	tsk := m.CreateTask()
+	if _, err := m.AddFiles(tsk.ID, []string{"https://a.org/a.pdf", "https://b.org/b.pdf"}); err != nil {
+		t.Fatalf("add files: %v", err)
+	}
+
+	if _, err := m.ReplaceFile(tsk.ID, 1, "https://c.org/c.jpeg"); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	if _, err := m.ReplaceFile(tsk.ID, 0, "https://c.org/c.exe"); !errors.Is(err, ErrExtNotAllowed) {
+		t.Fatalf("expected ErrExtNotAllowed on replace, got %v", err)
+	}
+	if _, err := m.RemoveFile(tsk.ID, 5); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("expected ErrFileNotFound, got %v", err)
+	}
+
+	got, err := m.RemoveFile(tsk.ID, 0)
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if len(got.Files) != 1 || got.Files[0].URL != "https://c.org/c.jpeg" {
+		t.Fatalf("unexpected files after remove: %+v", got.Files)
+	}
+	if strings.Contains(got.Title, "a.org") || !strings.Contains(got.Title, "c.org") {
+		t.Fatalf("title not updated: %q", got.Title)
+	}
+	if RemainingSlots(got) != MaxFilesPerTask-1 {
+		t.Fatalf("expected %d remaining slots, got %d", MaxFilesPerTask-1, RemainingSlots(got))
+	}
+
+	m2 := NewManagerWithOptions(Options{DataDir: m.dataDir, AllowedExtensions: []string{".pdf", ".jpeg"}, MaxConcurrentTasks: 1})
+	if err := m2.LoadFromDisk(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if reloaded, ok := m2.GetTask(tsk.ID); !ok || len(reloaded.Files) != 1 || reloaded.Title != got.Title {
+		t.Fatalf("changes not persisted: %+v", reloaded)
+	}
+}
+
+func TestRemoveFileRejectsQueuedTask(t *testing.T) {
+	m := newTestManager(t)
+	blocker := make(chan struct{})
+	m.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		<-blocker
+		return make([]archive.Result, len(urls)), nil
+	})
+	tsk := m.CreateTask()
+	if _, err := m.AddFiles(tsk.ID, []string{"https://e.org/a.pdf", "https://e.org/b.pdf", "https://e.org/c.pdf"}); err != nil {
+		t.Fatalf("add files: %v", err)
+	}
+	if _, err := m.RemoveFile(tsk.ID, 0); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected ErrInvalidState, got %v", err)
+	}
+	close(blocker)
+	m.WaitAll(context.Background())
+}
+
+func stringUpload(name, content string) Upload {
+	return Upload{Name: name, Open: func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(content)), nil }}
+}
+
+func TestAddUploadsValidation(t *testing.T) {
+	m := newTestManager(t)
+	tsk := m.CreateTask()
+
+	if _, err := m.AddUploads(context.Background(), tsk.ID, []Upload{stringUpload("a.exe", "MZ")}); !errors.Is(err, ErrExtNotAllowed) {
+		t.Fatalf("expected ErrExtNotAllowed, got %v", err)
+	}
+	_, err := m.AddUploads(context.Background(), tsk.ID, []Upload{stringUpload("a.pdf", "%PDF-1.4 ok"), stringUpload("b.pdf", "<html>not a pdf</html>")})
+	var contentErr *ContentMismatchError
+	if !errors.As(err, &contentErr) || contentErr.Ext != ".pdf" {
+		t.Fatalf("expected ContentMismatchError, got %v", err)
+	}
+	if entries, _ := os.ReadDir(m.uploadDir(tsk.ID)); len(entries) != 0 {
+		t.Fatalf("rejected batch must not leave files behind, found %d", len(entries))
+	}
+	if _, err := m.AddFiles(tsk.ID, []string{"file:///etc/passwd.pdf"}); !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL for file scheme, got %v", err)
+	}
+	if _, err := m.AddFiles(tsk.ID, []string{"upload://a.pdf"}); !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL for upload scheme, got %v", err)
+	}
+
+	if _, err := m.AddFiles(tsk.ID, []string{"https://e.org/a.pdf", "https://e.org/b.pdf"}); err != nil {
+		t.Fatalf("add files: %v", err)
+	}
+	if _, err := m.AddUploads(context.Background(), tsk.ID, []Upload{stringUpload("c.pdf", "%PDF-1.4"), stringUpload("d.pdf", "%PDF-1.4")}); !errors.Is(err, ErrTooManyFiles) {
+		t.Fatalf("expected ErrTooManyFiles, got %v", err)
+	}
+}
+
+func TestUploadsArePackedWithDownloads(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("%PDF-1.4 remote"))
+	}))
+	defer srv.Close()
+
+	m := newTestManager(t)
+	tsk := m.CreateTask()
+	if _, err := m.AddFiles(tsk.ID, []string{srv.URL + "/remote.pdf"}); err != nil {
+		t.Fatalf("add files: %v", err)
+	}
+	if _, err := m.AddUploads(context.Background(), tsk.ID, []Upload{stringUpload("local.pdf", "%PDF-1.4 local"), stringUpload("local.pdf", "%PDF-1.4 second")}); err != nil {
+		t.Fatalf("add uploads: %v", err)
+	}
+	m.WaitAll(context.Background())
+
+	got, _ := m.GetTask(tsk.ID)
+	if got.Status != StatusReady {
+		t.Fatalf("expected ready, got %s: %+v", got.Status, got.Files)
+	}
+	entries, err := archive.ListEntries(got.ArchivePath)
+	if err != nil {
+		t.Fatalf("list entries: %v", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, ",") != "remote.pdf,local.pdf,local(1).pdf" {
+		t.Fatalf("unexpected archive entries: %v", names)
+	}
+}
+
+func TestProcessingSpansLinkToRequest(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("%PDF-1.4 test"))
+	}))
+	defer srv.Close()
+
+	m := newTestManager(t)
+	reqCtx, reqSpan := provider.Tracer("test").Start(context.Background(), "POST /api/v1/tasks")
+	_, err := m.CreateTaskWithOptions(reqCtx, CreateOptions{
+		URLs: []string{srv.URL + "/a.pdf", srv.URL + "/b.pdf", srv.URL + "/c.pdf"},
+	})
+	reqSpan.End()
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !m.WaitAll(context.Background()) {
+		t.Fatalf("expected workers to finish")
+	}
+
+	byName := map[string][]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		byName[s.Name()] = append(byName[s.Name()], s)
+	}
+	process := byName["task.process"]
+	if len(process) != 1 {
+		t.Fatalf("expected one task.process span, got %d", len(process))
+	}
+	links := process[0].Links()
+	if len(links) != 1 || links[0].SpanContext.SpanID() != reqSpan.SpanContext().SpanID() {
+		t.Fatalf("expected task.process to link to the request span, got %+v", links)
+	}
+	builds := byName["archive.build"]
+	if len(builds) != 1 || builds[0].Parent().SpanID() != process[0].SpanContext().SpanID() {
+		t.Fatalf("expected archive.build as child of task.process")
+	}
+	downloads := byName["archive.download"]
+	if len(downloads) != 3 {
+		t.Fatalf("expected 3 download spans, got %d", len(downloads))
+	}
+	for _, d := range downloads {
+		if d.Parent().SpanID() != builds[0].SpanContext().SpanID() {
+			t.Fatalf("download span %s is not a child of archive.build", d.Name())
+		}
+	}
+	if len(byName["store.save_task"]) == 0 {
+		t.Fatalf("expected store spans")
+	}
+}
+
+func TestDrainRejectsNewTasks(t *testing.T) {
+	m := newTestManager(t)
+	m.Drain("maintenance")
+	_, err := m.CreateTaskWithOptions(context.Background(), CreateOptions{})
+	var drainErr *DrainingError
+	if !errors.Is(err, ErrDraining) || !errors.As(err, &drainErr) || drainErr.Reason != "maintenance" {
+		t.Fatalf("expected draining error with reason, got %v", err)
+	}
+
+	m.StopDraining()
+	if _, err := m.CreateTaskWithOptions(context.Background(), CreateOptions{}); err != nil {
+		t.Fatalf("expected create to succeed after drain is lifted: %v", err)
+	}
+}
+
+func TestPauseResumeAndResize(t *testing.T) {
+	m := newTestManager(t)
+	release := make(chan struct{})
+	started := make(chan string, 4)
+	m.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		started <- dest
+		<-release
+		f, err := os.Create(dest)
+		if err != nil {
+			return nil, err
+		}
+		_ = f.Close()
+		return make([]archive.Result, len(urls)), nil
+	})
+	urls := []string{"https://e.org/a.pdf", "https://e.org/b.pdf", "https://e.org/c.pdf"}
+
+	m.Pause()
+	first := m.CreateTask()
+	if _, err := m.AddFiles(first.ID, urls); err != nil {
+		t.Fatalf("add files: %v", err)
+	}
+	select {
+	case <-started:
+		t.Fatalf("processing must not start while paused")
+	case <-time.After(30 * time.Millisecond):
+	}
+	if state := m.ProcessingState(); !state.Paused || state.SlotsInUse != 0 {
+		t.Fatalf("unexpected state while paused: %+v", state)
+	}
+
+	m.Resume()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatalf("processing did not start after resume")
+	}
+	if workers := m.InFlight(); len(workers) != 1 || workers[0].TaskID != first.ID {
+		t.Fatalf("expected first task in flight, got %+v", workers)
+	}
+
+	second := m.CreateTask()
+	if _, err := m.AddFiles(second.ID, urls); err != nil {
+		t.Fatalf("add files: %v", err)
+	}
+	select {
+	case <-started:
+		t.Fatalf("second task must wait for a free slot")
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	if err := m.SetMaxConcurrentTasks(0); err == nil {
+		t.Fatalf("expected error for zero concurrency")
+	}
+	if err := m.SetMaxConcurrentTasks(2); err != nil {
+		t.Fatalf("resize: %v", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatalf("second task did not start after growing the pool")
+	}
+	if inUse, capacity := m.SlotUsage(); inUse != 2 || capacity != 2 {
+		t.Fatalf("expected 2/2 slots, got %d/%d", inUse, capacity)
+	}
+
+	close(release)
+	if !m.WaitAll(context.Background()) {
+		t.Fatalf("expected workers to finish")
+	}
+	if len(m.InFlight()) != 0 {
+		t.Fatalf("expected no workers after completion")
+	}
+}
+
+func TestSetAllowedExtensionsAtRuntime(t *testing.T) {
+	m := newTestManager(t)
+	tsk := m.CreateTask()
+	if _, err := m.AddFiles(tsk.ID, []string{"https://e.org/a.png"}); !errors.Is(err, ErrExtNotAllowed) {
+		t.Fatalf("expected .png to be rejected, got %v", err)
+	}
+	m.SetAllowedExtensions([]string{"PNG", ".pdf"})
+	if got := m.AllowedExtensions(); len(got) != 2 || got[0] != ".pdf" || got[1] != ".png" {
+		t.Fatalf("unexpected extensions: %v", got)
+	}
+	if _, err := m.AddFiles(tsk.ID, []string{"https://e.org/a.png"}); err != nil {
+		t.Fatalf("expected .png to be accepted after reload: %v", err)
+	}
+}
+
+// writeTestZip writes a valid archive with one stored entry of size bytes.
+func writeTestZip(dest string, size int) error {
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "f.pdf", Method: zip.Store})
+	if err == nil {
+		_, err = w.Write(make([]byte, size))
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	return errors.Join(err, f.Close())
+}
+
+func waitForStatus(t *testing.T, m *Manager, id string, want ...Status) *Task {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if got, ok := m.GetTask(id); ok {
+			m.mu.RLock()
+			status := got.Status
+			m.mu.RUnlock()
+			for _, w := range want {
+				if status == w {
+					return got
+				}
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for task %s to reach %v", id, want)
+	return nil
+}
+
+func TestQuotaExpiresLeastRecentlyDownloaded(t *testing.T) {
+	auditLog, err := audit.Open(audit.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("open audit: %v", err)
+	}
+	defer func() { _ = auditLog.Close() }()
+	m := NewManagerWithOptions(Options{
+		DataDir:            t.TempDir(),
+		AllowedExtensions:  []string{".pdf"},
+		MaxConcurrentTasks: 1,
+		Quota:              QuotaOptions{MaxArchiveBytes: 2500},
+		Audit:              auditLog,
+	})
+	m.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		if err := writeTestZip(dest, 1000); err != nil {
+			return nil, err
+		}
+		return make([]archive.Result, len(urls)), nil
+	})
+	urls := []string{"https://e.org/a.pdf", "https://e.org/b.pdf", "https://e.org/c.pdf"}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		created, err := m.CreateTaskWithOptions(context.Background(), CreateOptions{URLs: urls})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		waitForStatus(t, m, created.ID, StatusReady)
+		ids = append(ids, created.ID)
+		// The first archive is downloaded after the second one is built, so
+		// the second becomes the least recently used.
+		if i == 1 {
+			m.MarkDownloaded(context.Background(), ids[0])
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !m.WaitAll(ctx) {
+		t.Fatalf("workers did not finish")
+	}
+	expired := waitForStatus(t, m, ids[1], StatusExpired)
+	if expired.ExpiredAt == nil || expired.ArchivePath != "" {
+		t.Fatalf("expected expiry to be recorded, got %+v", expired)
+	}
+	if _, err := os.Stat(m.store.ArchivePath(ids[1])); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expired archive still on disk: %v", err)
+	}
+	if _, err := m.ReadyArchivePath(context.Background(), ids[1]); !errors.Is(err, ErrArchiveExpired) {
+		t.Fatalf("expected ErrArchiveExpired, got %v", err)
+	}
+	for _, id := range []string{ids[0], ids[2]} {
+		if got, _ := m.GetTask(id); got.Status != StatusReady {
+			t.Fatalf("task %s should stay ready, got %s", id, got.Status)
+		}
+	}
+	entries, _, err := auditLog.Query(audit.Filter{})
+	if err != nil || len(entries) != 1 || entries[0].Action != "archive.expire" || entries[0].TaskID != ids[1] || entries[0].Outcome != audit.OutcomeSuccess {
+		t.Fatalf("expected one archive.expire entry for %s, got %+v (%v)", ids[1], entries, err)
+	}
+}
+
+func TestProcessingRefusedWhenDiskIsFull(t *testing.T) {
+	m := NewManagerWithOptions(Options{
+		DataDir:            t.TempDir(),
+		AllowedExtensions:  []string{".pdf"},
+		MaxConcurrentTasks: 1,
+		Quota:              QuotaOptions{MinFreeBytes: 100 << 20},
+	})
+	m.freeSpace = func(string) (uint64, error) { return 10 << 20, nil }
+	var built atomic.Bool
+	m.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		built.Store(true)
+		return make([]archive.Result, len(urls)), nil
+	})
+
+	created, err := m.CreateTaskWithOptions(context.Background(), CreateOptions{URLs: []string{"https://e.org/a.pdf", "https://e.org/b.pdf", "https://e.org/c.pdf"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	failed := waitForStatus(t, m, created.ID, StatusFailed)
+	if built.Load() {
+		t.Fatalf("archive was built despite low disk space")
+	}
+	if !strings.Contains(failed.Files[0].Error, ErrInsufficientSpace.Error()) {
+		t.Fatalf("expected the failure to explain the disk space, got %q", failed.Files[0].Error)
+	}
+}
+
+func newClusterManager(t *testing.T, dataDir, instance string, cluster ClusterOptions) *Manager {
+	t.Helper()
+	cluster.Enabled = true
+	cluster.InstanceID = instance
+	m := NewManagerWithOptions(Options{
+		DataDir:            dataDir,
+		AllowedExtensions:  []string{".pdf"},
+		MaxConcurrentTasks: 1,
+		Cluster:            cluster,
+	})
+	if err := m.LoadFromDisk(); err != nil {
+		t.Fatalf("load %s: %v", instance, err)
+	}
+	return m
+}
+
+func TestClusterInstancesSeeEachOthersChanges(t *testing.T) {
+	dir := t.TempDir()
+	a := newClusterManager(t, dir, "a", ClusterOptions{})
+	b := newClusterManager(t, dir, "b", ClusterOptions{})
+
+	first, err := a.CreateTaskWithOptions(context.Background(), CreateOptions{})
+	if err != nil {
+		t.Fatalf("create on a: %v", err)
+	}
+	second, err := b.CreateTaskWithOptions(context.Background(), CreateOptions{})
+	if err != nil {
+		t.Fatalf("create on b: %v", err)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("instances created the same id %s", first.ID)
+	}
+
+	if _, err := a.AddFiles(first.ID, []string{"https://e.org/a.pdf"}); err != nil {
+		t.Fatalf("add on a: %v", err)
+	}
+	before, _ := a.GetTask(first.ID)
+	if _, err := b.AddFiles(first.ID, []string{"https://e.org/b.pdf"}); err != nil {
+		t.Fatalf("add on b: %v", err)
+	}
+	got, ok := a.GetTask(first.ID)
+	if !ok || len(got.Files) != 2 {
+		t.Fatalf("a should see the file added on b, got %+v", got)
+	}
+	if len(before.Files) != 1 {
+		t.Fatalf("a reload changed a task returned earlier: %+v", before)
+	}
+	if _, ok := a.GetTask(second.ID); !ok {
+		t.Fatalf("a should find the task created on b")
+	}
+}
+
+func TestClusterQuotaCountsArchivesOfOtherInstances(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	a := newClusterManager(t, dir, "a", ClusterOptions{})
+	a.quota.MaxArchiveBytes = 2500
+
+	// Both archives were built by another instance; a has never seen them.
+	store := NewFileStore(dir)
+	created := time.Now().Add(-time.Hour)
+	for i, id := range []string{"older", "newer"} {
+		ready := &Task{ID: id, Status: StatusReady, CreatedAt: created.Add(time.Duration(i) * time.Minute), ArchivePath: store.ArchivePath(id)}
+		if err := store.SaveTask(ctx, ready); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+		if err := os.WriteFile(ready.ArchivePath, make([]byte, 2000), 0o644); err != nil {
+			t.Fatalf("write archive: %v", err)
+		}
+	}
+
+	a.enforceQuota(ctx)
+	for id, want := range map[string]Status{"older": StatusExpired, "newer": StatusReady} {
+		got, err := store.LoadTask(ctx, id)
+		if err != nil || got.Status != want {
+			t.Fatalf("expected %s to be %s, got %+v (%v)", id, want, got, err)
+		}
+	}
+}
+
+func TestClusterTakesOverTaskOfDeadInstance(t *testing.T) {
+	dir := t.TempDir()
+	urls := []string{"https://e.org/a.pdf", "https://e.org/b.pdf", "https://e.org/c.pdf"}
+
+	dead := newClusterManager(t, dir, "dead", ClusterOptions{LeaseTTL: 200 * time.Millisecond})
+	deadCtx, stopDead := context.WithCancel(context.Background())
+	defer stopDead()
+	dead.SetBaseContext(deadCtx)
+	started := make(chan struct{})
+	dead.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	created, err := dead.CreateTaskWithOptions(context.Background(), CreateOptions{URLs: urls})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	<-started
+
+	// The dead instance never heartbeats, so its lease runs out.
+	alive := newClusterManager(t, dir, "alive", ClusterOptions{LeaseTTL: 200 * time.Millisecond})
+	alive.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		if err := writeTestZip(dest, 0); err != nil {
+			return nil, err
+		}
+		return make([]archive.Result, len(urls)), nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	alive.SetBaseContext(ctx)
+	alive.RunCluster(ctx)
+	waitForStatus(t, alive, created.ID, StatusReady)
+
+	// The late failure of the dead instance must not overwrite the result.
+	stopDead()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer waitCancel()
+	if !dead.WaitAll(waitCtx) || !alive.WaitAll(waitCtx) {
+		t.Fatalf("workers did not finish")
+	}
+	stored, err := alive.store.LoadTask(context.Background(), created.ID)
+	if err != nil || stored.Status != StatusReady {
+		t.Fatalf("expected the stored task to stay ready, got %+v, %v", stored, err)
+	}
+}
+
+func TestClusterLimitsConcurrencyAcrossInstances(t *testing.T) {
+	dir := t.TempDir()
+	urls := []string{"https://e.org/a.pdf", "https://e.org/b.pdf", "https://e.org/c.pdf"}
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	builder := func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		if n > peak.Load() {
+			peak.Store(n)
+		}
+		<-release
+		if err := writeTestZip(dest, 0); err != nil {
+			return nil, err
+		}
+		return make([]archive.Result, len(urls)), nil
+	}
+
+	var ids []string
+	for _, instance := range []string{"a", "b"} {
+		m := newClusterManager(t, dir, instance, ClusterOptions{MaxConcurrentTasks: 1})
+		m.UseArchiveBuilder(builder)
+		created, err := m.CreateTaskWithOptions(context.Background(), CreateOptions{URLs: urls})
+		if err != nil {
+			t.Fatalf("create on %s: %v", instance, err)
+		}
+		ids = append(ids, created.ID)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			m.WaitAll(ctx)
+		}()
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if got := running.Load(); got != 1 {
+		t.Fatalf("expected one task running across the cluster, got %d", got)
+	}
+	close(release)
+	observer := newClusterManager(t, dir, "observer", ClusterOptions{})
+	for _, id := range ids {
+		waitForStatus(t, observer, id, StatusReady)
+	}
+	if peak.Load() != 1 {
+		t.Fatalf("cluster limit exceeded, peak %d", peak.Load())
+	}
+}
+
+func TestArchiveIsVerifiedBeforePublishing(t *testing.T) {
+	urls := []string{"https://e.org/a.pdf", "https://e.org/b.pdf", "https://e.org/c.pdf"}
+
+	m := newTestManager(t)
+	m.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		if err := writeTestZip(dest, 64); err != nil {
+			return nil, err
+		}
+		return make([]archive.Result, len(urls)), nil
+	})
+	ready, err := m.CreateTaskWithOptions(context.Background(), CreateOptions{URLs: urls})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	got := waitForStatus(t, m, ready.ID, StatusReady)
+	sum, size, err := fileutil.SHA256(got.ArchivePath)
+	if err != nil {
+		t.Fatalf("hash archive: %v", err)
+	}
+	if got.ArchiveSHA256 != sum || got.ArchiveSize != size {
+		t.Fatalf("expected sha256 %s and size %d, got %s and %d", sum, size, got.ArchiveSHA256, got.ArchiveSize)
+	}
+
+	m = newTestManager(t)
+	m.UseArchiveBuilder(func(ctx context.Context, dest string, urls []string) ([]archive.Result, error) {
+		if err := writeTestZip(dest, 64); err != nil {
+			return nil, err
+		}
+		// Cut the archive short, as a crash mid-write would.
+		if err := os.Truncate(dest, 40); err != nil {
+			return nil, err
+		}
+		return make([]archive.Result, len(urls)), nil
+	})
+	broken, err := m.CreateTaskWithOptions(context.Background(), CreateOptions{URLs: urls})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	failed := waitForStatus(t, m, broken.ID, StatusFailed)
+	if !strings.Contains(failed.Files[0].Error, "archive verification failed") {
+		t.Fatalf("expected a verification error, got %q", failed.Files[0].Error)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !m.WaitAll(ctx) {
+		t.Fatalf("workers did not finish")
+	}
+	entries, err := os.ReadDir(filepath.Dir(m.store.ArchivePath(broken.ID)))
+	if err != nil {
+		t.Fatalf("read task dir: %v", err)
+	}
+	for _, e := range entries {
+		if e.Name() != "status.json" {
+			t.Fatalf("unexpected leftover %s after a failed build", e.Name())
+		}
+	}
+}
@@ -1,39 +1,84 @@
 package task
 
 import (
+	"archive/zip"
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"time"
 
 	"workmate/internal/back/archive"
 	fileutil "workmate/internal/back/file"
+	"workmate/internal/back/logging"
+	"workmate/internal/back/tracing"
 
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func (m *Manager) startProcessing(taskID string, slotAlreadyAcquired bool) {
-	if !slotAlreadyAcquired {
-		m.semaphore <- struct{}{}
+func (m *Manager) startProcessing(taskID string, origin trace.SpanContext, triggerRequestID string) {
+	defer m.slots.release()
+	m.trackWorker(taskID)
+	defer m.untrackWorker(taskID)
+
+	processingContext, cancel := context.WithCancel(m.processingContext())
+	defer cancel()
+	if !m.beginClusterWork(processingContext, taskID, cancel) {
+		return
+	}
+	defer m.endClusterWork(taskID)
+
+	spanOpts := []trace.SpanStartOption{trace.WithAttributes(attribute.String("task.id", taskID))}
+	if origin.IsValid() {
+		spanOpts = append(spanOpts, trace.WithLinks(trace.Link{SpanContext: origin}))
 	}
-	defer func() { <-m.semaphore }()
+	processingContext, span := tracing.Tracer().Start(processingContext, "task.process", spanOpts...)
+	defer span.End()
 
 	m.mu.Lock()
 	taskToProcess, taskFound := m.tasks[taskID]
 	if !taskFound {
 		m.mu.Unlock()
+		span.SetStatus(codes.Error, ErrTaskNotFound.Error())
 		return
 	}
 	taskToProcess.Status = StatusInProgress
+	requestID := taskToProcess.RequestID
 	m.mu.Unlock()
-	if err := m.persistTask(taskToProcess); err != nil {
-		log.Warn().Str("task_id", taskToProcess.ID).Err(err).Msg("persist in_progress failed")
+	if requestID == "" {
+		requestID = triggerRequestID
+	}
+	processingContext = logging.WithRequestID(processingContext, requestID)
+	log.Ctx(processingContext).Info().Str("task_id", taskID).Str("triggered_by", triggerRequestID).Msg("processing started")
+	if err := m.saveTask(processingContext, taskToProcess, EventStarted); err != nil {
+		log.Ctx(processingContext).Warn().Str("task_id", taskToProcess.ID).Err(err).Msg("persist in_progress failed")
 	}
 
 	taskDirectory := filepath.Join(m.dataDir, "tasks", taskToProcess.ID)
 	if err := fileutil.EnsureDir(taskDirectory); err != nil {
-		m.failTask(taskToProcess, "failed to create task dir: "+err.Error())
+		m.failTask(processingContext, taskToProcess, "failed to create task dir: "+err.Error())
+		return
+	}
+	if err := m.checkFreeSpace(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "insufficient disk space")
+		log.Ctx(processingContext).Warn().Str("task_id", taskToProcess.ID).Err(err).Msg("processing refused")
+		m.failTask(processingContext, taskToProcess, err.Error())
 		return
 	}
 	destinationZipPath := filepath.Join(taskDirectory, "archive.zip")
+	buildPath, err := reserveBuildPath(taskDirectory)
+	if err != nil {
+		m.failTask(processingContext, taskToProcess, "failed to create temp archive: "+err.Error())
+		return
+	}
+	// Only a verified archive is renamed into place; anything still at
+	// buildPath when processing ends is garbage.
+	defer removeBuildFile(processingContext, buildPath)
 
 	urlsToProcess := make([]string, 0, len(taskToProcess.Files))
 	for _, fileRef := range taskToProcess.Files {
@@ -45,15 +90,42 @@ func (m *Manager) startProcessing(taskID string, slotAlreadyAcquired bool) {
 		builder = archive.BuildArchive
 	}
 
-	processingContext := m.baseCtx
-	if processingContext == nil {
-		processingContext = context.Background()
+	if timeout := time.Duration(m.downloadTimeout.Load()); timeout > 0 {
+		processingContext = archive.WithHTTPTimeout(processingContext, timeout)
+	}
+	processingContext = archive.WithCompression(processingContext, zipMethod(taskToProcess.Compression))
+	processingContext = archive.WithUploadDir(processingContext, m.uploadDir(taskToProcess.ID))
+	archiveResults, err := builder(processingContext, buildPath, urlsToProcess)
+	if m.leaseLost(processingContext, taskToProcess.ID) {
+		span.SetStatus(codes.Error, "lease lost")
+		return
 	}
-	archiveResults, err := builder(processingContext, destinationZipPath, urlsToProcess)
 	if err != nil {
-		m.failTask(taskToProcess, err.Error())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "archive build failed")
+		m.failTask(processingContext, taskToProcess, err.Error())
 		return
 	}
+	var (
+		archiveSHA256 string
+		archiveSize   int64
+	)
+	if archivedAny(archiveResults) {
+		archiveSHA256, archiveSize, err = publishBuild(buildPath, destinationZipPath)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "archive verification failed")
+			m.failTask(processingContext, taskToProcess, err.Error())
+			return
+		}
+		span.SetAttributes(attribute.String("archive.sha256", archiveSHA256))
+		if err := m.archives.Put(processingContext, taskToProcess.ID, destinationZipPath); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "archive upload failed")
+			m.failTask(processingContext, taskToProcess, "archive upload failed: "+err.Error())
+			return
+		}
+	}
 
 	m.mu.Lock()
 	for i := range taskToProcess.Files {
@@ -77,16 +149,32 @@ func (m *Manager) startProcessing(taskID string, slotAlreadyAcquired bool) {
 	if anyFilesOK {
 		taskToProcess.Status = StatusReady
 		taskToProcess.ArchivePath = destinationZipPath
+		taskToProcess.ArchiveSHA256 = archiveSHA256
+		taskToProcess.ArchiveSize = archiveSize
 	} else {
 		taskToProcess.Status = StatusFailed
 	}
+	finalStatus := taskToProcess.Status
+	events := make([]Event, 0, len(taskToProcess.Files)+1)
+	for i := range taskToProcess.Files {
+		events = append(events, Event{Type: EventFileFinished, File: &i})
+	}
 	m.mu.Unlock()
-	if err := m.persistTask(taskToProcess); err != nil {
-		log.Warn().Str("task_id", taskToProcess.ID).Err(err).Msg("persist final state failed")
+	completion := EventCompleted
+	if finalStatus == StatusFailed {
+		completion = EventFailed
+	}
+	events = append(events, Event{Type: completion})
+	span.SetAttributes(attribute.String("task.status", string(finalStatus)))
+	if err := m.recordEvents(processingContext, taskToProcess, events...); err != nil {
+		log.Ctx(processingContext).Warn().Str("task_id", taskToProcess.ID).Err(err).Msg("persist final state failed")
+	}
+	if finalStatus == StatusReady {
+		m.enforceQuota(processingContext)
 	}
 }
 
-func (m *Manager) failTask(taskEntity *Task, msg string) {
+func (m *Manager) failTask(ctx context.Context, taskEntity *Task, msg string) {
 	m.mu.Lock()
 	taskEntity.Status = StatusFailed
 
@@ -97,7 +185,78 @@ func (m *Manager) failTask(taskEntity *Task, msg string) {
 		}
 	}
 	m.mu.Unlock()
-	if err := m.persistTask(taskEntity); err != nil {
-		log.Warn().Str("task_id", taskEntity.ID).Err(err).Msg("persist failed state failed")
+	removeBuildLeftovers(ctx, filepath.Join(m.dataDir, "tasks", taskEntity.ID))
+	if err := m.saveTask(ctx, taskEntity, EventFailed); err != nil {
+		log.Ctx(ctx).Warn().Str("task_id", taskEntity.ID).Err(err).Msg("persist failed state failed")
+	}
+}
+
+// buildTempPattern names archives under construction; the .tmp- prefix lets
+// fsck collect them when a crash leaves one behind.
+const buildTempPattern = ".tmp-archive-*.zip"
+
+func reserveBuildPath(taskDirectory string) (string, error) {
+	f, err := os.CreateTemp(taskDirectory, buildTempPattern)
+	if err != nil {
+		return "", err
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		_ = os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+// publishBuild checks the archive at buildPath entry by entry and renames it
+// to destination, so readers never see a partial archive. The archive and
+// the rename are flushed to disk before the task can be marked ready, so a
+// crash cannot leave a ready task with a truncated archive.
+func publishBuild(buildPath, destination string) (string, int64, error) {
+	if err := archive.Verify(buildPath); err != nil {
+		return "", 0, fmt.Errorf("archive verification failed: %w", err)
+	}
+	sum, size, err := fileutil.SHA256(buildPath)
+	if err != nil {
+		return "", 0, fmt.Errorf("archive checksum failed: %w", err)
+	}
+	if err := fileutil.SyncFile(buildPath); err != nil {
+		return "", 0, fmt.Errorf("flush archive: %w", err)
+	}
+	if err := os.Rename(buildPath, destination); err != nil {
+		return "", 0, fmt.Errorf("publish archive: %w", err)
+	}
+	if err := fileutil.SyncDir(filepath.Dir(destination)); err != nil {
+		return "", 0, fmt.Errorf("flush task dir: %w", err)
+	}
+	return sum, size, nil
+}
+
+func removeBuildFile(ctx context.Context, path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Ctx(ctx).Warn().Str("path", path).Err(err).Msg("remove temp archive failed")
+	}
+}
+
+func removeBuildLeftovers(ctx context.Context, taskDirectory string) {
+	leftovers, _ := filepath.Glob(filepath.Join(taskDirectory, buildTempPattern))
+	for _, path := range leftovers {
+		removeBuildFile(ctx, path)
+	}
+}
+
+func zipMethod(c Compression) uint16 {
+	if c == CompressionStore {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+func archivedAny(results []archive.Result) bool {
+	for _, r := range results {
+		if r.Err == "" {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,140 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	fileutil "workmate/internal/back/file"
+)
+
+const (
+	quarantineDirName = "quarantine"
+	reasonFile        = "reason.json"
+	// recordFile holds the raw record for stores that do not keep one
+	// status.json per task.
+	recordFile = "record.json"
+	// quarantineStamp suffixes quarantine directory names. It has no dash,
+	// so the task id is everything before the last one.
+	quarantineStamp = "20060102T150405.000000000Z"
+)
+
+var ErrCorruptRecords = errors.New("corrupt task records found")
+
+// QuarantinedRecord is the reason file written next to a quarantined task.
+type QuarantinedRecord struct {
+	TaskID        string    `json:"task_id"`
+	Reason        string    `json:"reason"`
+	Source        string    `json:"source,omitempty"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+	Dir           string    `json:"dir"`
+}
+
+// quarantineTarget picks a fresh directory under DataDir/quarantine for a
+// task and moves the task directory there when it exists.
+func quarantineTarget(dataDir, taskID string) (string, error) {
+	root := filepath.Join(dataDir, quarantineDirName)
+	if err := fileutil.EnsureDir(root); err != nil {
+		return "", err
+	}
+	name := filepath.Base(taskID) + "-" + time.Now().UTC().Format(quarantineStamp)
+	target := filepath.Join(root, name)
+
+	source := filepath.Join(dataDir, "tasks", filepath.Base(taskID))
+	if err := os.Rename(source, target); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("move task dir: %w", err)
+		}
+		if err := fileutil.EnsureDir(target); err != nil {
+			return "", err
+		}
+	}
+	return target, nil
+}
+
+func writeReason(target string, failed RecordError) (QuarantinedRecord, error) {
+	record := QuarantinedRecord{
+		TaskID:        failed.TaskID,
+		Reason:        failed.Reason,
+		Source:        failed.Path,
+		QuarantinedAt: time.Now().UTC(),
+		Dir:           filepath.Base(target),
+	}
+	if err := fileutil.WriteJSONAtomic(filepath.Join(target, reasonFile), record); err != nil {
+		return QuarantinedRecord{}, fmt.Errorf("write reason: %w", err)
+	}
+	return record, nil
+}
+
+// ListQuarantine returns the quarantined records under dataDir, newest
+// first.
+func ListQuarantine(dataDir string) ([]QuarantinedRecord, error) {
+	root := filepath.Join(dataDir, quarantineDirName)
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	records := make([]QuarantinedRecord, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(root, e.Name(), reasonFile))
+		if err != nil {
+			records = append(records, QuarantinedRecord{TaskID: quarantinedTaskID(e.Name()), Reason: "reason file missing", Dir: e.Name()})
+			continue
+		}
+		var record QuarantinedRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			record = QuarantinedRecord{TaskID: quarantinedTaskID(e.Name()), Reason: "reason file unreadable: " + err.Error()}
+		}
+		record.Dir = e.Name()
+		records = append(records, record)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].QuarantinedAt.After(records[j].QuarantinedAt)
+	})
+	return records, nil
+}
+
+// quarantinedTaskID recovers the task id from a quarantine directory name.
+// Task ids contain dashes themselves, so only the trailing stamp is cut off.
+func quarantinedTaskID(dirName string) string {
+	if i := strings.LastIndex(dirName, "-"); i > 0 {
+		return dirName[:i]
+	}
+	return dirName
+}
+
+// quarantineFailed moves every unusable record from the last load out of the
+// store and logs a summary line per record.
+func (m *Manager) quarantineFailed(ctx context.Context, failed []RecordError) []QuarantinedRecord {
+	moved := make([]QuarantinedRecord, 0, len(failed))
+	for _, f := range failed {
+		if isReserved(m.store, f.TaskID) {
+			continue
+		}
+		record, err := m.store.Quarantine(ctx, f)
+		if err != nil {
+			log.Error().Str("task_id", f.TaskID).Err(err).Msg("quarantine task record failed")
+			continue
+		}
+		log.Warn().Str("task_id", f.TaskID).Str("reason", f.Reason).Str("dir", record.Dir).Msg("task record quarantined")
+		moved = append(moved, record)
+	}
+	return moved
+}
+
+// Quarantined lists the records in DataDir/quarantine.
+func (m *Manager) Quarantined() ([]QuarantinedRecord, error) {
+	return ListQuarantine(m.dataDir)
+}
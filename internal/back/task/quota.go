@@ -0,0 +1,204 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"workmate/internal/back/audit"
+)
+
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+type QuotaOptions struct {
+	// MinFreeBytes is the free space under DataDir a task needs before its
+	// archive is built; 0 disables the check.
+	MinFreeBytes uint64
+	// MaxArchiveBytes caps the total size of ready archives under DataDir;
+	// 0 means unlimited. Archives over the cap are expired least recently
+	// downloaded first.
+	MaxArchiveBytes int64
+}
+
+// checkFreeSpace reports ErrInsufficientSpace when DataDir is below the
+// configured free space. Platforms without statfs skip the check.
+func (m *Manager) checkFreeSpace() error {
+	if m.quota.MinFreeBytes == 0 {
+		return nil
+	}
+	free, err := m.freeSpace(m.dataDir)
+	if err != nil {
+		log.Debug().Err(err).Msg("free space check skipped")
+		return nil
+	}
+	if free < m.quota.MinFreeBytes {
+		return fmt.Errorf("%w: %d MiB free under data dir, %d MiB required", ErrInsufficientSpace, free>>20, m.quota.MinFreeBytes>>20)
+	}
+	return nil
+}
+
+// MarkDownloaded records an archive download; the quota evicts the archives
+// downloaded least recently first.
+func (m *Manager) MarkDownloaded(ctx context.Context, taskID string) {
+	unlock, err := m.lockTask(ctx, taskID)
+	if err != nil {
+		log.Ctx(ctx).Warn().Str("task_id", taskID).Err(err).Msg("lock task for download time failed")
+		return
+	}
+	defer unlock()
+
+	m.mu.Lock()
+	t, ok := m.tasks[taskID]
+	if !ok || t.Status != StatusReady {
+		m.mu.Unlock()
+		return
+	}
+	now := time.Now().UTC()
+	t.LastDownloadedAt = &now
+	m.mu.Unlock()
+	if err := m.saveTask(ctx, t, EventDownloaded); err != nil {
+		log.Ctx(ctx).Warn().Str("task_id", taskID).Err(err).Msg("persist download time failed")
+	}
+}
+
+type quotaCandidate struct {
+	task     *Task
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+// quotaCandidates lists the ready archives. In a cluster this instance only
+// caches the tasks it has seen, so the archives are listed from the store
+// shared by every instance.
+func (m *Manager) quotaCandidates(ctx context.Context) ([]quotaCandidate, error) {
+	var ready []*Task
+	if m.cluster != nil {
+		stored, err := m.store.QueryTasks(ctx, Query{Status: StatusReady})
+		if err != nil {
+			return nil, err
+		}
+		ready = stored
+	} else {
+		m.mu.RLock()
+		for _, t := range m.tasks {
+			if t.Status == StatusReady {
+				ready = append(ready, t.clone())
+			}
+		}
+		m.mu.RUnlock()
+	}
+	var candidates []quotaCandidate
+	for _, t := range ready {
+		if t.Status != StatusReady || t.ArchivePath == "" {
+			continue
+		}
+		lastUsed := t.CreatedAt
+		if t.LastDownloadedAt != nil {
+			lastUsed = *t.LastDownloadedAt
+		}
+		candidates = append(candidates, quotaCandidate{task: t, path: t.ArchivePath, lastUsed: lastUsed})
+	}
+	return candidates, nil
+}
+
+// enforceQuota expires ready archives, least recently downloaded first,
+// until the archives under DataDir fit into MaxArchiveBytes. Tasks never
+// downloaded count as used when they were created.
+func (m *Manager) enforceQuota(ctx context.Context) {
+	if m.quota.MaxArchiveBytes <= 0 {
+		return
+	}
+	m.quotaMu.Lock()
+	defer m.quotaMu.Unlock()
+
+	candidates, err := m.quotaCandidates(ctx)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("list archives for quota failed")
+		return
+	}
+
+	var total int64
+	for i := range candidates {
+		if info, err := os.Stat(candidates[i].path); err == nil {
+			candidates[i].size = info.Size()
+			total += info.Size()
+		}
+	}
+	if total <= m.quota.MaxArchiveBytes {
+		return
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastUsed.Before(candidates[j].lastUsed)
+	})
+	for _, c := range candidates {
+		if total <= m.quota.MaxArchiveBytes {
+			break
+		}
+		if c.size == 0 {
+			continue
+		}
+		err := m.expireArchive(ctx, c.task.ID)
+		m.auditExpiry(c, err)
+		if err != nil {
+			log.Ctx(ctx).Warn().Str("task_id", c.task.ID).Err(err).Msg("expire archive failed")
+			continue
+		}
+		total -= c.size
+		log.Ctx(ctx).Info().Str("task_id", c.task.ID).Int64("size", c.size).Int64("total", total).
+			Int64("quota", m.quota.MaxArchiveBytes).Msg("archive expired by quota")
+	}
+}
+
+func (m *Manager) auditExpiry(c quotaCandidate, expireErr error) {
+	entry := audit.Entry{
+		Actor:   "system",
+		Channel: "quota",
+		Action:  "archive.expire",
+		TaskID:  c.task.ID,
+		Detail:  fmt.Sprintf("size=%d", c.size),
+	}
+	if expireErr != nil {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Detail += " error=" + expireErr.Error()
+	}
+	if err := m.audit.Record(entry); err != nil {
+		log.Warn().Str("task_id", c.task.ID).Err(err).Msg("audit record failed")
+	}
+}
+
+func (m *Manager) expireArchive(ctx context.Context, taskID string) error {
+	unlock, err := m.lockTask(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m.mu.Lock()
+	t, ok := m.tasks[taskID]
+	if !ok || t.Status != StatusReady {
+		m.mu.Unlock()
+		return nil
+	}
+	archivePath := t.ArchivePath
+	now := time.Now().UTC()
+	t.Status = StatusExpired
+	t.ArchivePath = ""
+	t.ArchiveSHA256 = ""
+	t.ArchiveSize = 0
+	t.ExpiredAt = &now
+	m.mu.Unlock()
+
+	// The status flips first so downloads report the expiry rather than a
+	// missing object while the files are being removed.
+	saveErr := m.saveTask(ctx, t, EventExpired)
+	deleteErr := m.archives.Delete(ctx, t.ID)
+	removeErr := os.Remove(archivePath)
+	if errors.Is(removeErr, os.ErrNotExist) {
+		removeErr = nil
+	}
+	return errors.Join(saveErr, deleteErr, removeErr)
+}
@@ -0,0 +1,145 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"workmate/internal/back/archive"
+)
+
+// CurrentSchemaVersion is written into every persisted task record. Records
+// without a schema_version field predate versioning and count as version 1.
+const CurrentSchemaVersion = 2
+
+var ErrNewerSchema = errors.New("record was written by a newer schema version")
+
+// recordMigration upgrades a raw record from version N to N+1. Migrations
+// work on the decoded JSON object so they can read fields the current Task
+// type no longer has.
+type recordMigration struct {
+	description string
+	up          func(record map[string]any) error
+}
+
+var migrations = map[int]recordMigration{
+	1: {description: "derive files[].source from the url scheme", up: migrateFileSources},
+}
+
+// RecordError describes a persisted task record that could not be loaded.
+type RecordError struct {
+	TaskID string `json:"task_id"`
+	Path   string `json:"path,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// LoadReport summarizes a store load: how many records were read, which
+// ones were upgraded to CurrentSchemaVersion and which ones were unusable.
+type LoadReport struct {
+	Loaded   int           `json:"loaded"`
+	Migrated []string      `json:"migrated,omitempty"`
+	Failed   []RecordError `json:"failed,omitempty"`
+	// NewerSchema lists records written by a newer release. They are not
+	// loaded but stay where they are, so that release can still read them.
+	NewerSchema []RecordError `json:"newer_schema,omitempty"`
+	// Quarantined lists the failed records that were moved aside.
+	Quarantined []QuarantinedRecord `json:"quarantined,omitempty"`
+}
+
+func (r *LoadReport) fail(taskID, path string, err error) {
+	record := RecordError{TaskID: taskID, Path: path, Reason: err.Error()}
+	if errors.Is(err, ErrNewerSchema) {
+		r.NewerSchema = append(r.NewerSchema, record)
+		log.Warn().Str("task_id", taskID).Str("path", path).Err(err).Msg("task record from a newer release skipped")
+		return
+	}
+	r.Failed = append(r.Failed, record)
+	log.Warn().Str("task_id", taskID).Str("path", path).Err(err).Msg("unusable task record")
+}
+
+// decodeRecord parses a persisted record, applying every registered
+// migration between its version and CurrentSchemaVersion. It reports whether
+// the record changed and therefore needs to be written back.
+func decodeRecord(raw []byte) (*Task, bool, error) {
+	var record map[string]any
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, false, fmt.Errorf("decode record: %w", err)
+	}
+	version, err := recordVersion(record)
+	if err != nil {
+		return nil, false, err
+	}
+	if version > CurrentSchemaVersion {
+		return nil, false, fmt.Errorf("%w: %d > %d", ErrNewerSchema, version, CurrentSchemaVersion)
+	}
+
+	migrated := version < CurrentSchemaVersion
+	for ; version < CurrentSchemaVersion; version++ {
+		migration, ok := migrations[version]
+		if !ok {
+			return nil, false, fmt.Errorf("no migration from schema version %d", version)
+		}
+		if err := migration.up(record); err != nil {
+			return nil, false, fmt.Errorf("migrate v%d (%s): %w", version, migration.description, err)
+		}
+		record["schema_version"] = version + 1
+	}
+	if migrated {
+		if raw, err = json.Marshal(record); err != nil {
+			return nil, false, fmt.Errorf("encode migrated record: %w", err)
+		}
+	}
+
+	var t Task
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, false, fmt.Errorf("decode task: %w", err)
+	}
+	if t.ID == "" {
+		return nil, false, errors.New("record has no id")
+	}
+	return &t, migrated, nil
+}
+
+func recordVersion(record map[string]any) (int, error) {
+	raw, ok := record["schema_version"]
+	if !ok {
+		return 1, nil
+	}
+	version, ok := raw.(float64)
+	if !ok || version < 1 || version != float64(int(version)) {
+		return 0, fmt.Errorf("invalid schema_version %v", raw)
+	}
+	return int(version), nil
+}
+
+// versionedRecord returns a copy of t stamped with the current schema
+// version, ready to be persisted.
+func versionedRecord(t *Task) *Task {
+	versioned := *t
+	versioned.SchemaVersion = CurrentSchemaVersion
+	return &versioned
+}
+
+func migrateFileSources(record map[string]any) error {
+	files, _ := record["files"].([]any)
+	for i, entry := range files {
+		file, ok := entry.(map[string]any)
+		if !ok {
+			return fmt.Errorf("files[%d] is not an object", i)
+		}
+		if source, _ := file["source"].(string); source != "" {
+			continue
+		}
+		url, _ := file["url"].(string)
+		if strings.HasPrefix(url, archive.UploadScheme) {
+			file["source"] = string(SourceUpload)
+		} else {
+			file["source"] = string(SourceURL)
+		}
+	}
+	if files == nil {
+		record["files"] = []any{}
+	}
+	return nil
+}
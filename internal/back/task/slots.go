@@ -0,0 +1,85 @@
+package task
+
+import (
+	"context"
+	"sync"
+)
+
+// slotPool is a counting semaphore whose capacity can change at runtime and
+// which can be paused so that no new slots are handed out.
+type slotPool struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	capacity int
+	inUse    int
+	paused   bool
+}
+
+func newSlotPool(capacity int) *slotPool {
+	p := &slotPool{capacity: capacity}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *slotPool) availableLocked() bool {
+	return !p.paused && p.inUse < p.capacity
+}
+
+func (p *slotPool) tryAcquire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.availableLocked() {
+		return false
+	}
+	p.inUse++
+	return true
+}
+
+func (p *slotPool) acquire(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	})
+	defer stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.availableLocked() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p.cond.Wait()
+	}
+	p.inUse++
+	return nil
+}
+
+func (p *slotPool) release() {
+	p.mu.Lock()
+	p.inUse--
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// resize never interrupts running workers: when shrinking, new slots are
+// simply not handed out until enough of them have finished.
+func (p *slotPool) resize(capacity int) {
+	p.mu.Lock()
+	p.capacity = capacity
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+func (p *slotPool) setPaused(paused bool) {
+	p.mu.Lock()
+	p.paused = paused
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+func (p *slotPool) state() (inUse, capacity int, paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inUse, p.capacity, p.paused
+}
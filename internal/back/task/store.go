@@ -2,30 +2,141 @@ package task
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	fileutil "workmate/internal/back/file"
+	"workmate/internal/back/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type TaskStore interface {
 	SaveTask(ctx context.Context, t *Task) error
-	LoadTasks(ctx context.Context) ([]*Task, error)
+	LoadTasks(ctx context.Context) ([]*Task, LoadReport, error)
+	// LoadTask reads a single record as last saved, or ErrTaskNotFound.
+	LoadTask(ctx context.Context, taskID string) (*Task, error)
+	QueryTasks(ctx context.Context, q Query) ([]*Task, error)
+	// DeleteTask removes the record and the task directory.
+	DeleteTask(ctx context.Context, taskID string) error
 	EnsureTaskDir(ctx context.Context, taskID string) (string, error)
 	ArchivePath(taskID string) string
+	// Quarantine moves an unusable record and its task directory to
+	// DataDir/quarantine together with a reason file.
+	Quarantine(ctx context.Context, failed RecordError) (QuarantinedRecord, error)
+	Close() error
+}
+
+const (
+	StoreDriverFile = "file"
+	StoreDriverBolt = "bolt"
+)
+
+// Query selects tasks by status and creation time; zero fields match
+// everything. Results are ordered by creation time.
+type Query struct {
+	Status Status
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+func (q Query) matchTime(t *Task) bool {
+	if !q.Since.IsZero() && t.CreatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !t.CreatedAt.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+type StoreOptions struct {
+	Driver  string
+	DataDir string
+	// Path of the database file for the bolt driver; defaults to
+	// DataDir/workmate.db.
+	Path string
+	// ReservationTTL is how long a task directory without status.json counts
+	// as an id another instance reserved rather than a broken record.
+	ReservationTTL time.Duration
+	// ReadOnly opens the store for inspection: records upgraded to the
+	// current schema are not written back and the bolt driver neither
+	// creates the database nor imports status.json files.
+	ReadOnly bool
+}
+
+// OpenStore opens the configured backend. The bolt driver imports existing
+// status.json records on first use.
+func OpenStore(ctx context.Context, opts StoreOptions) (TaskStore, error) {
+	switch opts.Driver {
+	case "", StoreDriverFile:
+		store := NewFileStore(opts.DataDir).(*fileStore)
+		if opts.ReservationTTL > 0 {
+			store.reservationTTL = opts.ReservationTTL
+		}
+		store.readOnly = opts.ReadOnly
+		return store, nil
+	case StoreDriverBolt:
+		path := opts.Path
+		if path == "" {
+			path = filepath.Join(opts.DataDir, "workmate.db")
+		}
+		store, err := openBoltStore(opts.DataDir, path, opts.ReadOnly)
+		if err != nil {
+			return nil, err
+		}
+		if opts.ReadOnly {
+			return store, nil
+		}
+		imported, err := store.migrateFromFiles(ctx)
+		if err != nil {
+			_ = store.Close()
+			return nil, fmt.Errorf("migrate file store: %w", err)
+		}
+		if imported > 0 {
+			log.Info().Int("tasks", imported).Str("path", path).Msg("imported status.json records into the database")
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", opts.Driver)
+	}
 }
 
 type fileStore struct {
-	dataDir string
+	dataDir        string
+	reservationTTL time.Duration
+	readOnly       bool
 }
 
 func NewFileStore(dataDir string) TaskStore {
 	if dataDir == "" {
 		dataDir = "storage/data"
 	}
-	return &fileStore{dataDir: dataDir}
+	return &fileStore{dataDir: dataDir, reservationTTL: defaultLeaseTTL}
+}
+
+// reserved reports whether taskID has a directory but no status.json yet and
+// the directory is younger than the reservation TTL. Cluster instances create
+// the directory to claim a new id before the first save.
+func (s *fileStore) reserved(taskID string) bool {
+	if _, err := os.Stat(s.statusPath(taskID)); !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	info, err := os.Stat(s.taskDir(taskID))
+	return err == nil && time.Since(info.ModTime()) < s.reservationTTL
+}
+
+// isReserved reports whether store holds a fresh id reservation for taskID.
+func isReserved(store TaskStore, taskID string) bool {
+	r, ok := store.(interface{ reserved(taskID string) bool })
+	return ok && r.reserved(taskID)
 }
 
 func (s *fileStore) taskDir(taskID string) string {
@@ -48,40 +159,128 @@ func (s *fileStore) EnsureTaskDir(ctx context.Context, taskID string) (string, e
 	return dir, nil
 }
 
-func (s *fileStore) SaveTask(ctx context.Context, t *Task) error {
+func (s *fileStore) SaveTask(ctx context.Context, t *Task) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "store.save_task", trace.WithAttributes(
+		attribute.String("task.id", t.ID),
+		attribute.String("task.status", string(t.Status)),
+	))
+	defer func() { endSpan(span, err) }()
+
 	if _, err := s.EnsureTaskDir(ctx, t.ID); err != nil {
 		return err
 	}
-	if err := fileutil.WriteJSONAtomic(s.statusPath(t.ID), t); err != nil {
+	if err := fileutil.WriteJSONAtomic(s.statusPath(t.ID), versionedRecord(t)); err != nil {
 		return fmt.Errorf("write status: %w", err)
 	}
 	return nil
 }
 
-func (s *fileStore) LoadTasks(ctx context.Context) ([]*Task, error) {
+// LoadTasks reads every status.json, upgrading records written with an older
+// schema version in place. Unusable records are skipped and listed in the
+// report.
+func (s *fileStore) LoadTasks(ctx context.Context) (_ []*Task, report LoadReport, err error) {
+	_, span := tracing.Tracer().Start(ctx, "store.load_tasks")
+	defer func() { endSpan(span, err) }()
+
 	root := filepath.Join(s.dataDir, "tasks")
 	entries, err := os.ReadDir(root)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, nil
+			return nil, report, nil
 		}
-		return nil, fmt.Errorf("read dir: %w", err)
+		return nil, report, fmt.Errorf("read dir: %w", err)
 	}
 	tasks := make([]*Task, 0, len(entries))
 	for _, e := range entries {
 		if !e.IsDir() {
 			continue
 		}
-		b, err := os.ReadFile(s.statusPath(e.Name()))
+		path := s.statusPath(e.Name())
+		raw, err := os.ReadFile(path)
 		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && s.reserved(e.Name()) {
+				continue
+			}
+			report.fail(e.Name(), path, err)
 			continue
 		}
-		var t Task
-		if err := json.Unmarshal(b, &t); err != nil {
+		t, migrated, err := decodeRecord(raw)
+		if err != nil {
+			report.fail(e.Name(), path, err)
 			continue
 		}
-		tt := t
-		tasks = append(tasks, &tt)
+		if migrated && !s.readOnly {
+			if err := fileutil.WriteJSONAtomic(path, versionedRecord(t)); err != nil {
+				report.fail(t.ID, path, fmt.Errorf("rewrite migrated record: %w", err))
+				continue
+			}
+			t.SchemaVersion = CurrentSchemaVersion
+			report.Migrated = append(report.Migrated, t.ID)
+		}
+		tasks = append(tasks, t)
+	}
+	report.Loaded = len(tasks)
+	span.SetAttributes(
+		attribute.Int("store.tasks_loaded", len(tasks)),
+		attribute.Int("store.tasks_migrated", len(report.Migrated)),
+		attribute.Int("store.tasks_failed", len(report.Failed)),
+	)
+	return tasks, report, nil
+}
+
+func (s *fileStore) LoadTask(ctx context.Context, taskID string) (*Task, error) {
+	raw, err := os.ReadFile(s.statusPath(filepath.Base(taskID)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrTaskNotFound
+		}
+		return nil, fmt.Errorf("read status: %w", err)
+	}
+	t, _, err := decodeRecord(raw)
+	return t, err
+}
+
+func (s *fileStore) QueryTasks(ctx context.Context, q Query) ([]*Task, error) {
+	all, _, err := s.LoadTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*Task, 0, len(all))
+	for _, t := range all {
+		if (q.Status == "" || t.Status == q.Status) && q.matchTime(t) {
+			tasks = append(tasks, t)
+		}
+	}
+	sortByCreated(tasks)
+	if q.Limit > 0 && len(tasks) > q.Limit {
+		tasks = tasks[:q.Limit]
 	}
 	return tasks, nil
 }
+
+func (s *fileStore) Quarantine(ctx context.Context, failed RecordError) (QuarantinedRecord, error) {
+	target, err := quarantineTarget(s.dataDir, failed.TaskID)
+	if err != nil {
+		return QuarantinedRecord{}, err
+	}
+	return writeReason(target, failed)
+}
+
+func (s *fileStore) DeleteTask(ctx context.Context, taskID string) error {
+	if err := os.RemoveAll(s.taskDir(filepath.Base(taskID))); err != nil {
+		return fmt.Errorf("remove task dir: %w", err)
+	}
+	return nil
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,532 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltStoreMigratesAndIndexes(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	legacy := NewFileStore(dataDir)
+	for i, status := range []Status{StatusReady, StatusFailed, StatusReady} {
+		legacyTask := &Task{ID: "legacy0" + string(rune('1'+i)), Status: status, CreatedAt: base.Add(time.Duration(i) * time.Hour)}
+		if err := legacy.SaveTask(ctx, legacyTask); err != nil {
+			t.Fatalf("save legacy: %v", err)
+		}
+	}
+
+	store, err := OpenStore(ctx, StoreOptions{Driver: StoreDriverBolt, DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("open bolt store: %v", err)
+	}
+	loaded, _, err := store.LoadTasks(ctx)
+	if err != nil || len(loaded) != 3 {
+		t.Fatalf("expected 3 migrated tasks, got %d (%v)", len(loaded), err)
+	}
+
+	moved := &Task{ID: "legacy02", Status: StatusReady, CreatedAt: base.Add(time.Hour)}
+	if err := store.SaveTask(ctx, moved); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	ready, err := store.QueryTasks(ctx, Query{Status: StatusReady})
+	if err != nil || len(ready) != 3 {
+		t.Fatalf("expected 3 ready tasks after status change, got %d (%v)", len(ready), err)
+	}
+	if failed, _ := store.QueryTasks(ctx, Query{Status: StatusFailed}); len(failed) != 0 {
+		t.Fatalf("stale status index entry: %+v", failed)
+	}
+	window, err := store.QueryTasks(ctx, Query{Since: base.Add(30 * time.Minute), Until: base.Add(2 * time.Hour)})
+	if err != nil || len(window) != 1 || window[0].ID != "legacy02" {
+		t.Fatalf("expected only legacy02 in window, got %+v (%v)", window, err)
+	}
+	if got := store.ArchivePath("legacy01"); got != filepath.Join(dataDir, "tasks", "legacy01", "archive.zip") {
+		t.Fatalf("unexpected archive path %s", got)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// A second open must not re-import files that changed since the migration.
+	if err := legacy.SaveTask(ctx, &Task{ID: "legacy09", Status: StatusCreated, CreatedAt: base}); err != nil {
+		t.Fatalf("save legacy: %v", err)
+	}
+	store, err = OpenStore(ctx, StoreOptions{Driver: StoreDriverBolt, DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if loaded, _, _ := store.LoadTasks(ctx); len(loaded) != 3 {
+		t.Fatalf("expected migration to run once, got %d tasks", len(loaded))
+	}
+}
+
+func TestJournalReplayAndCompaction(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	opts := Options{DataDir: dataDir, AllowedExtensions: []string{".pdf"}, MaxConcurrentTasks: 1, Journal: JournalOptions{Enabled: true, CompactEvery: 100}}
+
+	m := NewManagerWithOptions(opts)
+	if err := m.LoadFromDisk(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	created, err := m.CreateTaskWithOptions(ctx, CreateOptions{URLs: []string{"https://example.com/a.pdf"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := m.AddFilesContext(ctx, created.ID, []string{"https://example.com/b.pdf"}); err != nil {
+		t.Fatalf("add files: %v", err)
+	}
+	// Nothing was snapshotted yet: the state lives only in the journal.
+	if snapshot, _, _ := NewFileStore(dataDir).LoadTasks(ctx); len(snapshot) != 0 {
+		t.Fatalf("expected no snapshot before compaction, got %d", len(snapshot))
+	}
+
+	// Simulate a crash in the middle of an append.
+	journalPath := filepath.Join(dataDir, "journal", journalFile)
+	f, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	_, _ = f.WriteString(`{"seq":99,"type":"files_added","task_id":"`)
+	_ = f.Close()
+
+	m2 := NewManagerWithOptions(opts)
+	if err := m2.LoadFromDisk(); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	restored, ok := m2.GetTask(created.ID)
+	if !ok || len(restored.Files) != 2 {
+		t.Fatalf("expected task with 2 files after replay, got %+v", restored)
+	}
+	// Replay compacts right away, so the store has the snapshot and the
+	// journal is empty.
+	if snapshot, _, _ := NewFileStore(dataDir).LoadTasks(ctx); len(snapshot) != 1 || len(snapshot[0].Files) != 2 {
+		t.Fatalf("expected compacted snapshot, got %+v", snapshot)
+	}
+	if info, err := os.Stat(journalPath); err != nil || info.Size() != 0 {
+		t.Fatalf("expected empty journal after compaction, got %v (%v)", info, err)
+	}
+
+	if _, err := m2.AddFilesContext(ctx, created.ID, []string{"https://example.com/c.png"}); err == nil {
+		t.Fatalf("expected extension error")
+	}
+	if err := m2.CloseJournal(ctx); err != nil {
+		t.Fatalf("close journal: %v", err)
+	}
+	m3 := NewManagerWithOptions(opts)
+	if err := m3.LoadFromDisk(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if again, ok := m3.GetTask(created.ID); !ok || len(again.Files) != 2 {
+		t.Fatalf("expected snapshot to survive reopen, got %+v", again)
+	}
+}
+
+// stallingStore holds SaveTask until release is closed and then fails it.
+type stallingStore struct {
+	TaskStore
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *stallingStore) SaveTask(ctx context.Context, t *Task) error {
+	select {
+	case s.entered <- struct{}{}:
+	default:
+	}
+	<-s.release
+	return errors.New("disk on fire")
+}
+
+func TestJournalAppendsWhileCompacting(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	store := &stallingStore{TaskStore: NewFileStore(dataDir), entered: make(chan struct{}, 1), release: make(chan struct{})}
+	opts := Options{DataDir: dataDir, AllowedExtensions: []string{".pdf"}, MaxConcurrentTasks: 1, Journal: JournalOptions{Enabled: true, CompactEvery: 100}}
+	stalled := opts
+	stalled.Store = store
+
+	m := NewManagerWithOptions(stalled)
+	if err := m.LoadFromDisk(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	created, err := m.CreateTaskWithOptions(ctx, CreateOptions{URLs: []string{"https://example.com/a.pdf"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	compacted := make(chan error, 1)
+	go func() { compacted <- m.Compact(ctx) }()
+	<-store.entered
+
+	added := make(chan error, 1)
+	go func() {
+		_, err := m.AddFilesContext(ctx, created.ID, []string{"https://example.com/b.pdf"})
+		added <- err
+	}()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatalf("add files: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("append blocked by a running compaction")
+	}
+	close(store.release)
+	if err := <-compacted; err == nil {
+		t.Fatalf("expected the compaction to fail")
+	}
+	if pending, _ := JournalPending(dataDir); !pending {
+		t.Fatalf("events of a failed compaction must stay pending")
+	}
+
+	// A restart after the failed compaction still sees every event.
+	m2 := NewManagerWithOptions(opts)
+	if err := m2.LoadFromDisk(); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	restored, ok := m2.GetTask(created.ID)
+	if !ok || len(restored.Files) != 2 {
+		t.Fatalf("expected task with 2 files after replay, got %+v", restored)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "journal", asideFile)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the moved events to be merged back, got %v", err)
+	}
+	_ = m2.CloseJournal(ctx)
+}
+
+func TestLoadMigratesLegacyRecords(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	write := func(id, body string) string {
+		dir := filepath.Join(dataDir, "tasks", id)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		path := filepath.Join(dir, "status.json")
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		return path
+	}
+	legacyPath := write("legacy01", `{"id":"legacy01","status":"ready","created_at":"2025-01-01T00:00:00Z","files":[{"url":"https://example.com/a.pdf","state":"ok"},{"url":"upload://b.pdf","state":"ok"}]}`)
+	futurePath := write("future01", `{"schema_version":99,"id":"future01","status":"ready"}`)
+	write("broken01", `{"id":`)
+
+	m := NewManagerWithOptions(Options{DataDir: dataDir, AllowedExtensions: []string{".pdf"}, MaxConcurrentTasks: 1})
+	if err := m.LoadFromDisk(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	report := m.LoadReport()
+	if report.Loaded != 1 || len(report.Migrated) != 1 || len(report.Failed) != 1 || len(report.NewerSchema) != 1 || report.NewerSchema[0].TaskID != "future01" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if len(report.Quarantined) != 1 || report.Quarantined[0].TaskID != "broken01" {
+		t.Fatalf("only the broken record should be quarantined, got %+v", report.Quarantined)
+	}
+	if _, err := os.Stat(futurePath); err != nil {
+		t.Fatalf("record from a newer release must stay in place: %v", err)
+	}
+	if _, ok := m.GetTask("future01"); ok {
+		t.Fatalf("record from a newer release must not be loaded")
+	}
+	migrated, ok := m.GetTask("legacy01")
+	if !ok || migrated.Files[0].Source != SourceURL || migrated.Files[1].Source != SourceUpload || migrated.SchemaVersion != CurrentSchemaVersion {
+		t.Fatalf("record was not migrated: %+v", migrated)
+	}
+
+	raw, err := os.ReadFile(legacyPath)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	rewritten, upgraded, err := decodeRecord(raw)
+	if err != nil || upgraded || rewritten.SchemaVersion != CurrentSchemaVersion {
+		t.Fatalf("expected record rewritten at version %d, got %+v (upgraded=%v, err=%v)", CurrentSchemaVersion, rewritten, upgraded, err)
+	}
+	if _, _, err := NewFileStore(dataDir).LoadTasks(ctx); err != nil {
+		t.Fatalf("second load: %v", err)
+	}
+}
+
+func TestReadOnlyStoreLeavesRecordsAlone(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	dir := filepath.Join(dataDir, "tasks", "legacy01")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	body := []byte(`{"id":"legacy01","status":"ready","created_at":"2025-01-01T00:00:00Z","files":[{"url":"https://example.com/a.pdf","state":"ok"}]}`)
+	path := filepath.Join(dir, "status.json")
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	files, err := OpenStore(ctx, StoreOptions{Driver: StoreDriverFile, DataDir: dataDir, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("open file store: %v", err)
+	}
+	tasks, report, err := files.LoadTasks(ctx)
+	if err != nil || len(tasks) != 1 || len(report.Migrated) != 0 {
+		t.Fatalf("expected the record loaded without migration, got %d tasks, %+v (%v)", len(tasks), report, err)
+	}
+	if raw, err := os.ReadFile(path); err != nil || !bytes.Equal(raw, body) {
+		t.Fatalf("read-only load rewrote the record: %s (%v)", raw, err)
+	}
+
+	if _, err := OpenStore(ctx, StoreOptions{Driver: StoreDriverBolt, DataDir: dataDir, ReadOnly: true}); err == nil {
+		t.Fatalf("read-only open must not create the database")
+	}
+	writer, err := OpenStore(ctx, StoreOptions{Driver: StoreDriverBolt, DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("open bolt store: %v", err)
+	}
+	defer writer.Close()
+	if _, err := OpenStore(ctx, StoreOptions{Driver: StoreDriverBolt, DataDir: dataDir, ReadOnly: true}); !errors.Is(err, ErrDataDirInUse) {
+		t.Fatalf("expected ErrDataDirInUse while the database is open for writing, got %v", err)
+	}
+}
+
+func TestCorruptRecordsAreQuarantined(t *testing.T) {
+	ctx := context.Background()
+	for _, driver := range []string{StoreDriverFile, StoreDriverBolt} {
+		t.Run(driver, func(t *testing.T) {
+			dataDir := t.TempDir()
+			store, err := OpenStore(ctx, StoreOptions{Driver: driver, DataDir: dataDir})
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			defer func() { _ = store.Close() }()
+			if err := store.SaveTask(ctx, &Task{ID: "good0001", Status: StatusReady, CreatedAt: time.Now()}); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+			corruptRecord(t, store, dataDir, "bad00001")
+
+			strict := NewManagerWithOptions(Options{DataDir: dataDir, Store: store, FailOnCorrupt: true})
+			if err := strict.LoadFromDisk(); !errors.Is(err, ErrCorruptRecords) {
+				t.Fatalf("expected fail-fast error, got %v", err)
+			}
+			if listed, _ := ListQuarantine(dataDir); len(listed) != 0 {
+				t.Fatalf("fail-fast mode must not move records, got %+v", listed)
+			}
+
+			m := NewManagerWithOptions(Options{DataDir: dataDir, Store: store})
+			if err := m.LoadFromDisk(); err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if _, ok := m.GetTask("good0001"); !ok {
+				t.Fatalf("expected the good record to load")
+			}
+			listed, err := m.Quarantined()
+			if err != nil || len(listed) != 1 || listed[0].TaskID != "bad00001" || listed[0].Reason == "" {
+				t.Fatalf("expected one quarantined record, got %+v (%v)", listed, err)
+			}
+			if _, err := os.Stat(filepath.Join(dataDir, "tasks", "bad00001")); !os.IsNotExist(err) {
+				t.Fatalf("expected task dir to be moved, got %v", err)
+			}
+			if _, report, _ := store.LoadTasks(ctx); len(report.Failed) != 0 {
+				t.Fatalf("quarantined record is still in the store: %+v", report)
+			}
+		})
+	}
+}
+
+func corruptRecord(t *testing.T, store TaskStore, dataDir, id string) {
+	t.Helper()
+	dir, err := store.EnsureTaskDir(context.Background(), id)
+	if err != nil {
+		t.Fatalf("ensure dir: %v", err)
+	}
+	if bs, ok := store.(*boltStore); ok {
+		err = bs.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(bucketTasks).Put([]byte(id), []byte("{not json"))
+		})
+	} else {
+		err = os.WriteFile(filepath.Join(dir, "status.json"), []byte("{not json"), 0o644)
+	}
+	if err != nil {
+		t.Fatalf("corrupt: %v", err)
+	}
+}
+
+func TestQuarantineListingWithoutReasonFile(t *testing.T) {
+	dataDir := t.TempDir()
+	const id = "2026-10-19_12-00-00-01"
+	target, err := quarantineTarget(dataDir, id)
+	if err != nil {
+		t.Fatalf("quarantine: %v", err)
+	}
+	listed, err := ListQuarantine(dataDir)
+	if err != nil || len(listed) != 1 {
+		t.Fatalf("expected one record, got %+v (%v)", listed, err)
+	}
+	if listed[0].TaskID != id || listed[0].Dir != filepath.Base(target) {
+		t.Fatalf("expected task id %s from dir %s, got %+v", id, filepath.Base(target), listed[0])
+	}
+}
+
+func TestFsckFindsAndFixesInconsistencies(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	store := NewFileStore(dataDir)
+
+	lost := &Task{ID: "lost", Status: StatusReady, ArchivePath: store.ArchivePath("lost"), Files: []FileRef{{URL: "http://x/a.pdf", State: FileOK}}}
+	stale := &Task{ID: "stale", Status: StatusFailed}
+	for _, task := range []*Task{lost, stale} {
+		if err := store.SaveTask(ctx, task); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	if err := os.WriteFile(store.ArchivePath("stale"), []byte("zip"), 0o644); err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+	orphan, _ := store.EnsureTaskDir(ctx, "orphan")
+	reserved, _ := store.EnsureTaskDir(ctx, "reserved")
+	tmp := filepath.Join(dataDir, "tasks", "stale", ".tmp-123")
+	if err := os.WriteFile(tmp, nil, 0o644); err != nil {
+		t.Fatalf("write tmp: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(tmp, old, old)
+	_ = os.Chtimes(orphan, old, old)
+
+	findings, err := Fsck(ctx, store, nil, dataDir, false)
+	if err != nil {
+		t.Fatalf("fsck: %v", err)
+	}
+	problems := map[FsckProblem]string{}
+	for _, f := range findings {
+		problems[f.Problem] = f.TaskID
+	}
+	want := map[FsckProblem]string{ProblemMissingArchive: "lost", ProblemOrphanedArchive: "stale", ProblemOrphanedDir: "orphan", ProblemStaleTemp: ""}
+	if len(findings) != len(want) {
+		t.Fatalf("expected %d findings, got %+v", len(want), findings)
+	}
+	for problem, id := range want {
+		if got, ok := problems[problem]; !ok || got != id {
+			t.Fatalf("expected %s for %q, got %+v", problem, id, findings)
+		}
+	}
+
+	if _, err := Fsck(ctx, store, nil, dataDir, true); err != nil {
+		t.Fatalf("fsck -fix: %v", err)
+	}
+	if findings, _ := Fsck(ctx, store, nil, dataDir, false); len(findings) != 0 {
+		t.Fatalf("expected a clean store after fix, got %+v", findings)
+	}
+	if _, err := os.Stat(orphan); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("orphaned dir was not removed: %v", err)
+	}
+	if _, err := os.Stat(reserved); err != nil {
+		t.Fatalf("fresh id reservation was removed: %v", err)
+	}
+	tasks, report, _ := store.LoadTasks(ctx)
+	if len(report.Failed) != 0 {
+		t.Fatalf("fresh id reservation reported as a broken record: %+v", report.Failed)
+	}
+	for _, task := range tasks {
+		if task.ID == "lost" && (task.Status != StatusFailed || task.Files[0].State != FileFailed) {
+			t.Fatalf("task with lost archive not marked failed: %+v", task)
+		}
+	}
+}
+
+func TestOfflineRepairsWaitForServerAndJournal(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	store := NewFileStore(dataDir)
+
+	server, err := LockDataDir(dataDir, false)
+	if err != nil {
+		t.Fatalf("server lock: %v", err)
+	}
+	peer, err := LockDataDir(dataDir, false)
+	if err != nil {
+		t.Fatalf("second server lock: %v", err)
+	}
+	if _, err := LockDataDir(dataDir, true); !errors.Is(err, ErrDataDirInUse) {
+		t.Fatalf("expected ErrDataDirInUse while servers run, got %v", err)
+	}
+	_ = server.Unlock()
+	_ = peer.Unlock()
+	repair, err := LockDataDir(dataDir, true)
+	if err != nil {
+		t.Fatalf("exclusive lock after servers stopped: %v", err)
+	}
+	defer func() { _ = repair.Unlock() }()
+
+	journalDir := filepath.Join(dataDir, "journal")
+	if err := os.MkdirAll(journalDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(journalDir, journalFile), []byte("{}\n"), 0o644); err != nil {
+		t.Fatalf("write journal: %v", err)
+	}
+	if _, err := Fsck(ctx, store, nil, dataDir, true); !errors.Is(err, ErrJournalPending) {
+		t.Fatalf("expected fsck -fix to refuse a pending journal, got %v", err)
+	}
+	if _, err := Fsck(ctx, store, nil, dataDir, false); err != nil {
+		t.Fatalf("read-only fsck with a pending journal: %v", err)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := NewFileStore(t.TempDir())
+	ready := &Task{ID: "ready1", Status: StatusReady, ArchivePath: source.ArchivePath("ready1"), CreatedAt: time.Now().UTC()}
+	if err := source.SaveTask(ctx, ready); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := os.WriteFile(source.ArchivePath("ready1"), []byte("zip bytes"), 0o644); err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if n, err := ExportTasks(ctx, source, &buf); err != nil || n != 1 {
+		t.Fatalf("export: %d, %v", n, err)
+	}
+	exported := buf.Bytes()
+
+	targetDir := t.TempDir()
+	target, err := OpenStore(ctx, StoreOptions{Driver: StoreDriverBolt, DataDir: targetDir})
+	if err != nil {
+		t.Fatalf("open target: %v", err)
+	}
+	defer func() { _ = target.Close() }()
+
+	result, err := ImportTasks(ctx, target, bytes.NewReader(exported), false)
+	if err != nil || len(result.Imported) != 1 {
+		t.Fatalf("import: %+v, %v", result, err)
+	}
+	tasks, _, _ := target.LoadTasks(ctx)
+	if len(tasks) != 1 || tasks[0].ArchivePath != target.ArchivePath("ready1") {
+		t.Fatalf("unexpected imported tasks %+v", tasks)
+	}
+	if body, err := os.ReadFile(target.ArchivePath("ready1")); err != nil || string(body) != "zip bytes" {
+		t.Fatalf("archive not imported: %q, %v", body, err)
+	}
+
+	result, err = ImportTasks(ctx, target, bytes.NewReader(exported), false)
+	if err != nil || len(result.Skipped) != 1 || len(result.Imported) != 0 {
+		t.Fatalf("expected existing task to be skipped: %+v, %v", result, err)
+	}
+}
+
+func TestImportRejectsEscapingPaths(t *testing.T) {
+	for _, name := range []string{"tasks/a/../../x", "/tasks/a/x", "tasks/../x/y", "other/a/x"} {
+		if _, _, ok := splitExportName(name); ok {
+			t.Fatalf("accepted %q", name)
+		}
+	}
+	if id, rel, ok := splitExportName("tasks/a/uploads/b.pdf"); !ok || id != "a" || rel != "uploads/b.pdf" {
+		t.Fatalf("rejected a valid entry: %s %s %v", id, rel, ok)
+	}
+}
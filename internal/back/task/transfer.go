@@ -0,0 +1,238 @@
+package task
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	exportManifest   = "manifest.json"
+	exportRecordName = "task.json"
+	exportTasksDir   = "tasks"
+)
+
+type exportManifestFile struct {
+	SchemaVersion int       `json:"schema_version"`
+	ExportedAt    time.Time `json:"exported_at"`
+	Tasks         int       `json:"tasks"`
+}
+
+// ExportTasks writes every task as a gzipped tarball laid out as
+// tasks/<id>/task.json plus the files of the task directory (archive,
+// uploads). The layout does not depend on the store driver.
+func ExportTasks(ctx context.Context, store TaskStore, w io.Writer) (int, error) {
+	tasks, _, err := store.LoadTasks(ctx)
+	if err != nil {
+		return 0, err
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(exportManifestFile{SchemaVersion: CurrentSchemaVersion, ExportedAt: time.Now().UTC(), Tasks: len(tasks)}, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if err := writeTarFile(tw, exportManifest, manifest, time.Now()); err != nil {
+		return 0, err
+	}
+
+	for _, t := range tasks {
+		record, err := json.MarshalIndent(versionedRecord(t), "", "  ")
+		if err != nil {
+			return 0, fmt.Errorf("encode task %s: %w", t.ID, err)
+		}
+		prefix := path.Join(exportTasksDir, t.ID)
+		if err := writeTarFile(tw, path.Join(prefix, exportRecordName), record, t.CreatedAt); err != nil {
+			return 0, err
+		}
+		dir := filepath.Dir(store.ArchivePath(t.ID))
+		if err := addTaskFiles(tw, dir, prefix); err != nil {
+			return 0, fmt.Errorf("export files of %s: %w", t.ID, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+	return len(tasks), nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, body []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(body)
+	return err
+}
+
+// addTaskFiles copies the regular files of a task directory except the
+// file store's own status.json and leftovers of atomic writes.
+func addTaskFiles(tw *tar.Writer, dir, prefix string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || d.Name() == "status.json" || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(prefix, filepath.ToSlash(rel))
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+type ImportResult struct {
+	Imported []string
+	Skipped  []string
+	Failed   []RecordError
+}
+
+// ImportTasks restores a tarball written by ExportTasks. Records go through
+// the schema migrations and existing tasks are kept unless overwrite is set.
+func ImportTasks(ctx context.Context, store TaskStore, r io.Reader, overwrite bool) (ImportResult, error) {
+	var result ImportResult
+	existing, _, err := store.LoadTasks(ctx)
+	if err != nil {
+		return result, err
+	}
+	present := make(map[string]bool, len(existing))
+	for _, t := range existing {
+		present[t.ID] = true
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return result, fmt.Errorf("open gzip: %w", err)
+	}
+	defer func() { _ = gz.Close() }()
+	tr := tar.NewReader(gz)
+
+	// Entries of one task are contiguous; decide per task whether to take it.
+	decided := make(map[string]bool)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return result, fmt.Errorf("read tarball: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg || header.Name == exportManifest {
+			continue
+		}
+		taskID, rel, ok := splitExportName(header.Name)
+		if !ok {
+			return result, fmt.Errorf("unexpected entry %q", header.Name)
+		}
+
+		take, seen := decided[taskID]
+		if !seen {
+			take = overwrite || !present[taskID]
+			decided[taskID] = take
+			if !take {
+				result.Skipped = append(result.Skipped, taskID)
+			}
+		}
+		if !take {
+			continue
+		}
+
+		if rel == exportRecordName {
+			raw, err := io.ReadAll(tr)
+			if err != nil {
+				return result, err
+			}
+			t, _, err := decodeRecord(raw)
+			if err != nil || t.ID != taskID {
+				if err == nil {
+					err = fmt.Errorf("record id %q does not match directory", t.ID)
+				}
+				result.Failed = append(result.Failed, RecordError{TaskID: taskID, Path: header.Name, Reason: err.Error()})
+				decided[taskID] = false
+				continue
+			}
+			if t.ArchivePath != "" {
+				t.ArchivePath = store.ArchivePath(t.ID)
+			}
+			if err := store.SaveTask(ctx, t); err != nil {
+				return result, fmt.Errorf("save task %s: %w", t.ID, err)
+			}
+			result.Imported = append(result.Imported, t.ID)
+			continue
+		}
+
+		dir, err := store.EnsureTaskDir(ctx, taskID)
+		if err != nil {
+			return result, err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return result, err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return result, err
+		}
+		_, copyErr := io.Copy(f, tr)
+		closeErr := f.Close()
+		if err := errors.Join(copyErr, closeErr); err != nil {
+			return result, fmt.Errorf("write %s: %w", target, err)
+		}
+	}
+}
+
+// splitExportName validates tasks/<id>/<rel> and rejects anything that could
+// escape the task directory.
+func splitExportName(name string) (taskID, rel string, ok bool) {
+	clean := path.Clean(name)
+	if clean != name || path.IsAbs(clean) {
+		return "", "", false
+	}
+	parts := strings.SplitN(clean, "/", 3)
+	if len(parts) != 3 || parts[0] != exportTasksDir || parts[1] == "" || parts[1] == "." || parts[1] == ".." {
+		return "", "", false
+	}
+	for _, segment := range strings.Split(parts[2], "/") {
+		if segment == ".." || segment == "" {
+			return "", "", false
+		}
+	}
+	return parts[1], parts[2], true
+}
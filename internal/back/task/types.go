@@ -1,6 +1,11 @@
 package task
 
-import "time"
+import (
+	"time"
+
+	"workmate/internal/back/audit"
+	"workmate/internal/back/storage"
+)
 
 type Status string
 
@@ -9,6 +14,9 @@ const (
 	StatusInProgress Status = "in_progress"
 	StatusReady      Status = "ready"
 	StatusFailed     Status = "failed"
+	// StatusExpired marks a ready task whose archive was evicted by the
+	// storage quota.
+	StatusExpired Status = "expired"
 )
 
 type FileState string
@@ -19,29 +27,101 @@ const (
 	FileFailed  FileState = "failed"
 )
 
+type ArchiveFormat string
+
+const (
+	FormatZip ArchiveFormat = "zip"
+)
+
+type Compression string
+
+const (
+	CompressionDeflate Compression = "deflate"
+	CompressionStore   Compression = "store"
+)
+
+type FileSource string
+
+const (
+	SourceURL    FileSource = "url"
+	SourceUpload FileSource = "upload"
+)
+
 type FileRef struct {
-	URL      string    `json:"url"`
-	State    FileState `json:"state"`
-	Error    string    `json:"error,omitempty"`
-	Filename string    `json:"filename,omitempty"`
+	URL      string     `json:"url"`
+	State    FileState  `json:"state"`
+	Error    string     `json:"error,omitempty"`
+	Filename string     `json:"filename,omitempty"`
+	Source   FileSource `json:"source,omitempty"`
 }
 
 type Task struct {
+	SchemaVersion int `json:"schema_version"`
+
 	ID          string    `json:"id"`
 	Status      Status    `json:"status"`
 	CreatedAt   time.Time `json:"created_at"`
 	Title       string    `json:"title"`
 	Files       []FileRef `json:"files"`
 	ArchivePath string    `json:"archive_path,omitempty"`
+	// ArchiveSHA256 and ArchiveSize describe the published archive.
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+	ArchiveSize   int64  `json:"archive_size,omitempty"`
+
+	CustomTitle string        `json:"custom_title,omitempty"`
+	Format      ArchiveFormat `json:"format,omitempty"`
+	Compression Compression   `json:"compression,omitempty"`
+	RequestID   string        `json:"request_id,omitempty"`
+
+	LastDownloadedAt *time.Time `json:"last_downloaded_at,omitempty"`
+	ExpiredAt        *time.Time `json:"expired_at,omitempty"`
+}
+
+type CreateOptions struct {
+	URLs        []string
+	Title       string
+	Format      ArchiveFormat
+	Compression Compression
+}
+
+type Worker struct {
+	TaskID    string
+	StartedAt time.Time
+}
+
+type ProcessingState struct {
+	Draining           bool
+	DrainReason        string
+	Paused             bool
+	MaxConcurrentTasks int
+	SlotsInUse         int
+	Workers            []Worker
 }
 
 type Options struct {
 	DataDir            string
 	AllowedExtensions  []string
 	MaxConcurrentTasks int
+	DownloadTimeout    time.Duration
+	// Store overrides the default file store rooted at DataDir.
+	Store   TaskStore
+	Journal JournalOptions
+	// FailOnCorrupt makes LoadFromDisk fail instead of quarantining
+	// unusable records.
+	FailOnCorrupt bool
+	// Archives receives every finished archive; defaults to local storage at
+	// Store.ArchivePath.
+	Archives storage.ArchiveStorage
+	Quota    QuotaOptions
+	Cluster  ClusterOptions
+	// Audit records the archives expired by the quota; nil disables it.
+	Audit *audit.Log
 }
 
+type extensionSet map[string]struct{}
+
 const (
 	MaxFilesPerTask      = 3
+	MaxTitleLength       = 200
 	defaultMaxConcurrent = 3
 )
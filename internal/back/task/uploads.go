@@ -0,0 +1,217 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"workmate/internal/back/archive"
+	fileutil "workmate/internal/back/file"
+)
+
+const (
+	uploadsDirName = "uploads"
+	sniffLen       = 512
+
+	// MaxUploadRequestBytes caps a whole multipart upload request.
+	MaxUploadRequestBytes = 64 << 20
+)
+
+var expectedContentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".zip":  "application/zip",
+}
+
+type Upload struct {
+	Name string
+	Open func() (io.ReadCloser, error)
+}
+
+func MultipartUploads(headers []*multipart.FileHeader) []Upload {
+	uploads := make([]Upload, 0, len(headers))
+	for _, header := range headers {
+		uploads = append(uploads, Upload{
+			Name: header.Filename,
+			Open: func() (io.ReadCloser, error) { return header.Open() },
+		})
+	}
+	return uploads
+}
+
+func (m *Manager) AddUploads(ctx context.Context, taskID string, uploads []Upload) (*Task, error) {
+	if len(uploads) == 0 {
+		return nil, ErrNoURLs
+	}
+	unlock, err := m.lockTask(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	m.mu.RLock()
+	currentTask, taskFound := m.tasks[taskID]
+	switch {
+	case !taskFound:
+		err = ErrTaskNotFound
+	case currentTask.Status != StatusCreated:
+		err = NewErrInvalidState(taskID, currentTask.Status)
+	case len(currentTask.Files)+len(uploads) > MaxFilesPerTask:
+		err = ErrTooManyFiles
+	}
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	taskDir, err := m.store.EnsureTaskDir(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	uploadDir := filepath.Join(taskDir, uploadsDirName)
+
+	refs := make([]FileRef, 0, len(uploads))
+	for _, upload := range uploads {
+		storedName, err := m.storeUpload(uploadDir, upload)
+		if err != nil {
+			removeUploads(uploadDir, refs)
+			return nil, err
+		}
+		refs = append(refs, FileRef{
+			URL:    archive.UploadScheme + storedName,
+			State:  FilePending,
+			Source: SourceUpload,
+		})
+	}
+
+	m.mu.Lock()
+	if currentTask.Status != StatusCreated {
+		m.mu.Unlock()
+		removeUploads(uploadDir, refs)
+		return nil, NewErrInvalidState(taskID, currentTask.Status)
+	}
+	if len(currentTask.Files)+len(refs) > MaxFilesPerTask {
+		m.mu.Unlock()
+		removeUploads(uploadDir, refs)
+		return nil, ErrTooManyFiles
+	}
+	currentTask.Files = append(currentTask.Files, refs...)
+	m.updateTaskTitle(currentTask)
+	// Processing may start changing the task as soon as it is launched.
+	result := currentTask.clone()
+	m.mu.Unlock()
+
+	if err := m.saveTask(ctx, currentTask, EventFilesAdded); err != nil {
+		log.Warn().Str("task_id", taskID).Err(err).Msg("persist after upload failed")
+		return nil, err
+	}
+
+	if len(result.Files) == MaxFilesPerTask {
+		m.launchProcessing(ctx, taskID)
+	}
+	return result, nil
+}
+
+func (m *Manager) storeUpload(uploadDir string, upload Upload) (string, error) {
+	name := sanitizeUploadName(upload.Name)
+	if err := m.validateExtension(name); err != nil {
+		return "", err
+	}
+
+	uploadReader, err := upload.Open()
+	if err != nil {
+		return "", fmt.Errorf("open upload: %w", err)
+	}
+	defer func() { _ = uploadReader.Close() }()
+
+	contentReader := bufio.NewReaderSize(uploadReader, sniffLen)
+	head, err := contentReader.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", fmt.Errorf("read upload: %w", err)
+	}
+	if err := validateContent(filepath.Ext(name), head); err != nil {
+		return "", err
+	}
+
+	if err := fileutil.EnsureDir(uploadDir); err != nil {
+		return "", err
+	}
+	storedName, err := reserveUploadName(uploadDir, name)
+	if err != nil {
+		return "", err
+	}
+	if err := fileutil.CopyAtomic(filepath.Join(uploadDir, storedName), contentReader); err != nil {
+		_ = os.Remove(filepath.Join(uploadDir, storedName))
+		return "", fmt.Errorf("store upload: %w", err)
+	}
+	return storedName, nil
+}
+
+func validateContent(ext string, head []byte) error {
+	ext = strings.ToLower(ext)
+	expected, known := expectedContentTypes[ext]
+	if !known {
+		return nil
+	}
+	detected := http.DetectContentType(head)
+	if !strings.HasPrefix(detected, expected) {
+		return &ContentMismatchError{Ext: ext, Detected: detected}
+	}
+	return nil
+}
+
+func sanitizeUploadName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		return "upload"
+	}
+	return name
+}
+
+// reserveUploadName picks a free name in dir and creates an empty placeholder
+// so concurrent uploads with the same name cannot pick it too.
+func reserveUploadName(dir, name string) (string, error) {
+	candidate := name
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		placeholder, err := os.OpenFile(filepath.Join(dir, candidate), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+		if err == nil {
+			_ = placeholder.Close()
+			return candidate, nil
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("reserve upload name: %w", err)
+		}
+		candidate = fmt.Sprintf("%s(%d)%s", stem, i, ext)
+	}
+}
+
+func removeUploads(uploadDir string, refs []FileRef) {
+	for _, ref := range refs {
+		removeUpload(uploadDir, ref)
+	}
+}
+
+func removeUpload(uploadDir string, ref FileRef) {
+	if ref.Source != SourceUpload {
+		return
+	}
+	storedName := filepath.Base(strings.TrimPrefix(ref.URL, archive.UploadScheme))
+	if err := os.Remove(filepath.Join(uploadDir, storedName)); err != nil && !os.IsNotExist(err) {
+		log.Warn().Str("upload", storedName).Err(err).Msg("remove upload failed")
+	}
+}
+
+func (m *Manager) uploadDir(taskID string) string {
+	return filepath.Join(m.dataDir, "tasks", taskID, uploadsDirName)
+}
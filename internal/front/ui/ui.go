@@ -4,10 +4,13 @@ import (
 	"embed"
 	"html/template"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 
+	"workmate/internal/back/audit"
+	"workmate/internal/back/problem"
 	"workmate/internal/back/task"
 )
 
@@ -31,6 +34,9 @@ func (u *UI) RegisterRoutes(router *gin.Engine) {
 	router.POST("/ui/tasks", u.UICreateTask)
 	router.GET("/ui/tasks/:id", u.UITask)
 	router.POST("/ui/tasks/:id/files", u.UIAddFiles)
+	router.POST("/ui/tasks/:id/uploads", u.UIUploadFiles)
+	router.POST("/ui/tasks/:id/files/:index", u.UIReplaceFile)
+	router.POST("/ui/tasks/:id/files/:index/delete", u.UIRemoveFile)
 }
 
 func (u *UI) UIHome(c *gin.Context) { c.HTML(http.StatusOK, "home", gin.H{}) }
@@ -45,42 +51,122 @@ func (u *UI) UIOpenExisting(c *gin.Context) {
 }
 
 func (u *UI) UICreateTask(c *gin.Context) {
-	if u.taskManager.IsBusy() {
-		c.HTML(http.StatusServiceUnavailable, "home", gin.H{"Error": "server busy: try again later"})
+	t, err := u.taskManager.CreateTaskWithOptions(c.Request.Context(), task.CreateOptions{
+		URLs:        nonEmpty(c.PostFormArray("urls")),
+		Title:       c.PostForm("title"),
+		Compression: task.Compression(c.PostForm("compression")),
+	})
+	if err != nil {
+		u.renderProblem(c, "home", gin.H{}, err)
 		return
 	}
-	t := u.taskManager.CreateTask()
+	c.Set(audit.TaskIDKey, t.ID)
 	c.Redirect(http.StatusFound, "/ui/tasks/"+t.ID)
 }
 
 func (u *UI) UITask(c *gin.Context) {
 	id := c.Param("id")
 	if t, ok := u.taskManager.GetTask(id); ok {
-		c.HTML(http.StatusOK, "task", gin.H{"Task": t, "content": "content-task"})
+		data := u.taskData(t)
+		data["content"] = "content-task"
+		c.HTML(http.StatusOK, "task", data)
 		return
 	}
-	c.HTML(http.StatusNotFound, "home", gin.H{"Error": "task not found"})
+	u.renderProblem(c, "home", gin.H{}, task.ErrTaskNotFound)
 }
 
 func (u *UI) UIAddFiles(c *gin.Context) {
 	id := c.Param("id")
-	urls := c.PostFormArray("urls")
-	filtered := make([]string, 0, len(urls))
-	for _, raw := range urls {
-		raw = strings.TrimSpace(raw)
-		if raw != "" {
-			filtered = append(filtered, raw)
+	filtered := nonEmpty(c.PostFormArray("urls"))
+	if len(filtered) > 0 {
+		if _, err := u.taskManager.AddFilesContext(c.Request.Context(), id, filtered); err != nil {
+			u.renderTaskProblem(c, id, err)
+			return
 		}
 	}
-	if len(filtered) > 0 {
-		if _, err := u.taskManager.AddFiles(id, filtered); err != nil {
-			if t, ok := u.taskManager.GetTask(id); ok {
-				c.HTML(http.StatusBadRequest, "task", gin.H{"Task": t, "Error": err.Error()})
-				return
-			}
-			c.HTML(http.StatusBadRequest, "home", gin.H{"Error": err.Error()})
+	c.Redirect(http.StatusFound, "/ui/tasks/"+id)
+}
+
+func (u *UI) UIUploadFiles(c *gin.Context) {
+	id := c.Param("id")
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, task.MaxUploadRequestBytes)
+	form, err := c.MultipartForm()
+	if err != nil {
+		u.renderTaskProblem(c, id, problem.ErrInvalidRequest)
+		return
+	}
+	defer func() { _ = form.RemoveAll() }()
+
+	if headers := form.File["files"]; len(headers) > 0 {
+		if _, err := u.taskManager.AddUploads(c.Request.Context(), id, task.MultipartUploads(headers)); err != nil {
+			u.renderTaskProblem(c, id, err)
 			return
 		}
 	}
 	c.Redirect(http.StatusFound, "/ui/tasks/"+id)
 }
+
+func (u *UI) UIReplaceFile(c *gin.Context) {
+	id := c.Param("id")
+	index, err := strconv.Atoi(c.Param("index"))
+	if err == nil {
+		_, err = u.taskManager.ReplaceFile(id, index, c.PostForm("url"))
+	} else {
+		err = task.ErrFileNotFound
+	}
+	if err != nil {
+		u.renderTaskProblem(c, id, err)
+		return
+	}
+	c.Redirect(http.StatusFound, "/ui/tasks/"+id)
+}
+
+func (u *UI) UIRemoveFile(c *gin.Context) {
+	id := c.Param("id")
+	index, err := strconv.Atoi(c.Param("index"))
+	if err == nil {
+		_, err = u.taskManager.RemoveFile(id, index)
+	} else {
+		err = task.ErrFileNotFound
+	}
+	if err != nil {
+		u.renderTaskProblem(c, id, err)
+		return
+	}
+	c.Redirect(http.StatusFound, "/ui/tasks/"+id)
+}
+
+func (u *UI) renderTaskProblem(c *gin.Context, id string, err error) {
+	if t, ok := u.taskManager.GetTask(id); ok {
+		u.renderProblem(c, "task", u.taskData(t), err)
+		return
+	}
+	u.renderProblem(c, "home", gin.H{}, err)
+}
+
+// taskData is the template data of the task page. Accept follows the
+// allowed extensions, which may change on a config reload.
+func (u *UI) taskData(t *task.Task) gin.H {
+	return gin.H{"Task": t, "Accept": strings.Join(u.taskManager.AllowedExtensions(), ",")}
+}
+
+func (u *UI) renderProblem(c *gin.Context, name string, data gin.H, err error) {
+	p := problem.FromError(err)
+	data["Error"] = p.Title
+	if p.Detail != "" {
+		data["Error"] = p.Detail
+	}
+	data["ErrorCode"] = p.Code
+	c.HTML(p.Status, name, data)
+}
+
+func nonEmpty(values []string) []string {
+	filtered := make([]string, 0, len(values))
+	for _, raw := range values {
+		raw = strings.TrimSpace(raw)
+		if raw != "" {
+			filtered = append(filtered, raw)
+		}
+	}
+	return filtered
+}